@@ -1 +1,353 @@
-package api
\ No newline at end of file
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Roshan310/DaanVeer/blockchain"
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+type handlers struct {
+	bc *blockchain.Blockchain
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("api: failed to write response: %v", err)
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+type finalityResponse struct {
+	// FinalizedHeight is the height below which, inclusive, the chain can
+	// no longer change.
+	FinalizedHeight uint64 `json:"finalized_height"`
+	FinalizedHash   string `json:"finalized_hash"`
+	// Signers are the authorities whose precommits finalized the block.
+	Signers    []string `json:"signers"`
+	HeadHeight uint64   `json:"head_height"`
+}
+
+func (h *handlers) finality(w http.ResponseWriter, r *http.Request) {
+	// The head is read after the certificate so that it is never below the
+	// finalized block, whatever is added in between.
+	c := h.bc.Finalized()
+	resp := finalityResponse{Signers: []string{}, HeadHeight: h.bc.LastBlock().Header.Height}
+	if c != nil {
+		resp.FinalizedHeight = c.Height
+		resp.FinalizedHash = hex.EncodeToString(c.BlockHash)
+		for _, p := range c.Precommits {
+			resp.Signers = append(resp.Signers, p.Authority)
+		}
+	} else {
+		genesis, err := h.bc.BlockByHeight(0)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp.FinalizedHash = hex.EncodeToString(genesis.Hash())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type blockResponse struct {
+	Hash         string   `json:"hash"`
+	Version      uint32   `json:"version"`
+	Height       uint64   `json:"height"`
+	PreviousHash string   `json:"previous_hash"`
+	MerkleRoot   string   `json:"merkle_root"`
+	StateRoot    string   `json:"state_root"`
+	ReceiptsRoot string   `json:"receipts_root,omitempty"`
+	Timestamp    uint64   `json:"timestamp"`
+	Proposer     string   `json:"proposer"`
+	Canonical    bool     `json:"canonical"`
+	Transactions []string `json:"transactions"`
+}
+
+func (h *handlers) writeBlock(w http.ResponseWriter, b *blockchain.Block) {
+	canonical, _ := h.bc.BlockByHeight(b.Header.Height)
+	resp := blockResponse{
+		Hash:         hex.EncodeToString(b.Hash()),
+		Version:      b.Header.Version,
+		Height:       b.Header.Height,
+		PreviousHash: hex.EncodeToString(b.Header.PreviousHash),
+		MerkleRoot:   hex.EncodeToString(b.Header.MerkleRoot),
+		StateRoot:    hex.EncodeToString(b.Header.StateRoot),
+		ReceiptsRoot: hex.EncodeToString(b.Header.ReceiptsRoot),
+		Timestamp:    b.Header.Timestamp,
+		Proposer:     b.Header.Proposer,
+		Canonical:    canonical != nil && bytes.Equal(canonical.Hash(), b.Hash()),
+		Transactions: make([]string, len(b.Transactions)),
+	}
+	for i := range b.Transactions {
+		resp.Transactions[i] = hex.EncodeToString(b.Transactions[i].ID())
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handlers) blockByHash(w http.ResponseWriter, r *http.Request) {
+	hash, err := hex.DecodeString(r.PathValue("hash"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "block hash must be hex")
+		return
+	}
+	b, err := h.bc.BlockByHash(hash)
+	if errors.Is(err, blockchain.ErrBlockNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.writeBlock(w, b)
+}
+
+func (h *handlers) blockByHeight(w http.ResponseWriter, r *http.Request) {
+	height, err := strconv.ParseUint(r.PathValue("height"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "height must be a non-negative integer")
+		return
+	}
+	b, err := h.bc.BlockByHeight(height)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	h.writeBlock(w, b)
+}
+
+type transactionResponse struct {
+	ID        string            `json:"id"`
+	Hash      string            `json:"hash"`
+	BlockHash string            `json:"block_hash"`
+	Height    uint64            `json:"height"`
+	Index     int               `json:"index"`
+	Version   uint32            `json:"version"`
+	Kind      blockchain.TxKind `json:"kind"`
+	Payload   string            `json:"payload,omitempty"`
+	ChainID   string            `json:"chain_id,omitempty"`
+	Nonce     uint64            `json:"nonce"`
+	Sender    string            `json:"sender,omitempty"`
+	Recipient string            `json:"recipient"`
+	Value     blockchain.Amount `json:"value"`
+	Timestamp uint64            `json:"timestamp"`
+}
+
+func newTransactionResponse(tx *blockchain.Transactions, loc blockchain.TxLocation) transactionResponse {
+	resp := transactionResponse{
+		ID:        hex.EncodeToString(tx.ID()),
+		Hash:      hex.EncodeToString(tx.Hash()),
+		BlockHash: hex.EncodeToString(loc.BlockHash),
+		Height:    loc.Height,
+		Index:     loc.Index,
+		Version:   tx.Version,
+		Kind:      tx.Kind,
+		Payload:   hex.EncodeToString(tx.Payload),
+		ChainID:   tx.ChainID,
+		Nonce:     tx.Nonce,
+		Recipient: wallet.AddressFromPubKeyHash(tx.RecipientHash),
+		Value:     tx.Value,
+		Timestamp: tx.Timestamp,
+	}
+	if !tx.IsMint() {
+		resp.Sender = wallet.AddressFromPubKeyHash(tx.SenderHash)
+	}
+	return resp
+}
+
+func (h *handlers) transaction(w http.ResponseWriter, r *http.Request) {
+	id, err := hex.DecodeString(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "transaction ID must be hex")
+		return
+	}
+	tx, loc, ok := h.bc.Transaction(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "transaction not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newTransactionResponse(tx, loc))
+}
+
+type receiptResponse struct {
+	TxID      string            `json:"tx_id"`
+	Status    string            `json:"status"`
+	BlockHash string            `json:"block_hash"`
+	Height    uint64            `json:"height"`
+	Index     int               `json:"index"`
+	Fee       blockchain.Amount `json:"fee"`
+	Events    []eventResponse   `json:"events"`
+	Error     string            `json:"error,omitempty"`
+}
+
+type eventResponse struct {
+	Type       string                      `json:"type"`
+	Attributes []blockchain.EventAttribute `json:"attributes"`
+}
+
+func (h *handlers) receipt(w http.ResponseWriter, r *http.Request) {
+	id, err := hex.DecodeString(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "transaction ID must be hex")
+		return
+	}
+	receipt, ok, err := h.bc.Receipt(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "transaction not found")
+		return
+	}
+	resp := receiptResponse{
+		TxID:      hex.EncodeToString(receipt.TxID),
+		Status:    string(receipt.Status),
+		BlockHash: hex.EncodeToString(receipt.BlockHash),
+		Height:    receipt.Height,
+		Index:     receipt.Index,
+		Fee:       receipt.Fee,
+		Events:    []eventResponse{},
+		Error:     receipt.Error,
+	}
+	for _, event := range receipt.Events {
+		resp.Events = append(resp.Events, eventResponse{Type: event.Type, Attributes: event.Attributes})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handlers) addressTransactions(w http.ResponseWriter, r *http.Request) {
+	address, err := wallet.PubKeyFromAddress(r.PathValue("address"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+	resp := []transactionResponse{}
+	for _, loc := range h.bc.AddressTransactions(address) {
+		// By hash, since a reorganisation may replace the block at
+		// loc.Height once the locations have been read.
+		b, err := h.bc.BlockByHash(loc.BlockHash)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp = append(resp, newTransactionResponse(&b.Transactions[loc.Index], loc))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type campaignResponse struct {
+	ID              string                    `json:"id"`
+	Owner           string                    `json:"owner"`
+	Beneficiary     string                    `json:"beneficiary"`
+	Goal            blockchain.Amount         `json:"goal"`
+	Deadline        uint64                    `json:"deadline"`
+	DescriptionHash string                    `json:"description_hash"`
+	Status          blockchain.CampaignStatus `json:"status"`
+	Raised          blockchain.Amount         `json:"raised"`
+	Withdrawn       blockchain.Amount         `json:"withdrawn"`
+	DonorCount      int                       `json:"donor_count"`
+	Milestones      []blockchain.Amount       `json:"milestones"`
+	Released        uint32                    `json:"released"`
+}
+
+func (h *handlers) newCampaignResponse(c *blockchain.Campaign) campaignResponse {
+	return campaignResponse{
+		ID:              hex.EncodeToString(c.ID),
+		Owner:           wallet.AddressFromPubKeyHash(c.Owner),
+		Beneficiary:     wallet.AddressFromPubKeyHash(c.Beneficiary),
+		Goal:            c.Goal,
+		Deadline:        c.Deadline,
+		DescriptionHash: hex.EncodeToString(c.DescriptionHash),
+		Status:          h.bc.CampaignStatus(c),
+		Raised:          c.Raised,
+		Withdrawn:       c.Withdrawn,
+		DonorCount:      c.DonorCount(),
+		Milestones:      c.Milestones,
+		Released:        c.Released,
+	}
+}
+
+func (h *handlers) campaigns(w http.ResponseWriter, r *http.Request) {
+	resp := []campaignResponse{}
+	for _, c := range h.bc.Campaigns() {
+		resp = append(resp, h.newCampaignResponse(c))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// lookupCampaign finds the campaign named in the request path, writing an
+// error response if there is none.
+func (h *handlers) lookupCampaign(w http.ResponseWriter, r *http.Request) (*blockchain.Campaign, bool) {
+	id, err := hex.DecodeString(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "campaign ID must be hex")
+		return nil, false
+	}
+	c, ok := h.bc.Campaign(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "campaign not found")
+		return nil, false
+	}
+	return c, true
+}
+
+func (h *handlers) campaign(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.lookupCampaign(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, h.newCampaignResponse(c))
+}
+
+type contributionResponse struct {
+	Donor  string            `json:"donor"`
+	Amount blockchain.Amount `json:"amount"`
+}
+
+func (h *handlers) contributions(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.lookupCampaign(w, r)
+	if !ok {
+		return
+	}
+	resp := []contributionResponse{}
+	for _, contribution := range c.Contributions() {
+		resp = append(resp, contributionResponse{
+			Donor:  wallet.AddressFromPubKeyHash(contribution.Donor),
+			Amount: contribution.Amount,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handlers) contribution(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.lookupCampaign(w, r)
+	if !ok {
+		return
+	}
+	donor, err := wallet.PubKeyFromAddress(r.PathValue("address"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid address")
+		return
+	}
+	writeJSON(w, http.StatusOK, contributionResponse{
+		Donor:  r.PathValue("address"),
+		Amount: c.Contribution(donor),
+	})
+}
@@ -1 +1,36 @@
-package api
\ No newline at end of file
+package api
+
+import (
+	"net/http"
+
+	"github.com/Roshan310/DaanVeer/blockchain"
+)
+
+// Routes returns the HTTP API of a node serving bc.
+//
+//	GET /finality                            latest finalized block
+//	GET /blocks/{hash}                       block by hex hash
+//	GET /blocks/height/{height}              canonical block at a height
+//	GET /transactions/{id}                   transaction by hex ID
+//	GET /transactions/{id}/receipt           receipt of a transaction
+//	GET /addresses/{address}/transactions    transactions sent or received
+//	GET /campaigns                           every campaign
+//	GET /campaigns/{id}                      campaign by hex ID
+//	GET /campaigns/{id}/contributions        what each donor has given
+//	GET /campaigns/{id}/contributions/{address}
+//	                                         what one donor has given
+func Routes(bc *blockchain.Blockchain) http.Handler {
+	h := &handlers{bc: bc}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /finality", h.finality)
+	mux.HandleFunc("GET /blocks/{hash}", h.blockByHash)
+	mux.HandleFunc("GET /blocks/height/{height}", h.blockByHeight)
+	mux.HandleFunc("GET /transactions/{id}", h.transaction)
+	mux.HandleFunc("GET /transactions/{id}/receipt", h.receipt)
+	mux.HandleFunc("GET /addresses/{address}/transactions", h.addressTransactions)
+	mux.HandleFunc("GET /campaigns", h.campaigns)
+	mux.HandleFunc("GET /campaigns/{id}", h.campaign)
+	mux.HandleFunc("GET /campaigns/{id}/contributions", h.contributions)
+	mux.HandleFunc("GET /campaigns/{id}/contributions/{address}", h.contribution)
+	return mux
+}
@@ -1,9 +1,9 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"sort"
 )
 
 
@@ -36,8 +36,15 @@ func (node *MerkleNode) Print()  {
 }
 // MerkleTree represents the entire Merkle tree.
 type MerkleTree struct {
-	Root  *MerkleNode
-	Nodes []*MerkleNode // Keeps track of all nodes for generating proofs.
+	Scheme MerkleScheme
+	Root   *MerkleNode
+	Nodes  []*MerkleNode // The final level, holding only the root.
+	// Levels holds every level of the tree, leaves first and the root last,
+	// so the path from any leaf to the root can be read off by index.
+	// Levels are stored as built, before any odd node is paired.
+	Levels [][]*MerkleNode
+	// leafIndex maps a leaf hash to the first leaf with that hash.
+	leafIndex map[string]int
 }
 
 // NewMerkleNode creates a new Merkle node from two child nodes or a single transaction.
@@ -58,96 +65,208 @@ func NewMerkleNode(left, right *MerkleNode, hash []byte) *MerkleNode {
 	}
 }
 
-// NewMerkleTree constructs a Merkle tree from a list of transactions.
+// MerkleScheme selects how a Merkle tree hashes its leaves and nodes.
+type MerkleScheme byte
+
+const (
+	// MerkleSchemeLegacy is the original tree. Leaves are the transaction
+	// hashes themselves, leaves and nodes are hashed alike and an odd node
+	// is paired with a copy of itself. That makes the tree of [a, b, c] and
+	// [a, b, c, c] share a root, and lets an interior node pass for a leaf.
+	MerkleSchemeLegacy MerkleScheme = 0
+	// MerkleSchemeTagged hashes leaves as H(0x00 || hash) and nodes as
+	// H(0x01 || left || right), so the two can never be confused, and moves
+	// an odd node up a level unchanged instead of duplicating it.
+	MerkleSchemeTagged MerkleScheme = 1
+)
+
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+// MerkleSchemeFor returns the scheme of the transaction tree of blocks with
+// the given header version.
+func MerkleSchemeFor(blockVersion uint32) MerkleScheme {
+	if blockVersion >= 4 {
+		return MerkleSchemeTagged
+	}
+	return MerkleSchemeLegacy
+}
+
+func (scheme MerkleScheme) String() string {
+	switch scheme {
+	case MerkleSchemeLegacy:
+		return "legacy"
+	case MerkleSchemeTagged:
+		return "tagged"
+	}
+	return fmt.Sprintf("MerkleScheme(%d)", byte(scheme))
+}
+
+func (scheme MerkleScheme) valid() bool {
+	return scheme == MerkleSchemeLegacy || scheme == MerkleSchemeTagged
+}
+
+// hashLeaf returns the hash of the leaf node for data.
+func (scheme MerkleScheme) hashLeaf(data []byte) []byte {
+	if scheme == MerkleSchemeLegacy {
+		return data
+	}
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
+	return hash[:]
+}
+
+// hashNode returns the hash of the interior node with the given children.
+func (scheme MerkleScheme) hashNode(left, right []byte) []byte {
+	var data []byte
+	if scheme != MerkleSchemeLegacy {
+		data = append(data, merkleNodePrefix)
+	}
+	data = append(data, left...)
+	data = append(data, right...)
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
+
+// NewMerkleTree constructs a legacy Merkle tree from a list of transactions.
 func NewMerkleTree(transactions []Transactions) *MerkleTree {
-	if len(transactions) == 0 {
-		return &MerkleTree{Root: nil}
+	return NewMerkleTreeWithScheme(transactions, MerkleSchemeLegacy)
+}
+
+// NewMerkleTreeWithScheme constructs a Merkle tree from a list of
+// transactions using the given scheme.
+func NewMerkleTreeWithScheme(transactions []Transactions, scheme MerkleScheme) *MerkleTree {
+	hashes := make([][]byte, len(transactions))
+	for i := range transactions {
+		hashes[i] = transactions[i].Hash()
+	}
+	return NewMerkleTreeFromHashes(hashes, scheme)
+}
+
+// NewMerkleTreeFromHashes constructs a Merkle tree over a list of hashes,
+// such as transaction or receipt hashes, using the given scheme.
+func NewMerkleTreeFromHashes(hashes [][]byte, scheme MerkleScheme) *MerkleTree {
+	mt := &MerkleTree{Scheme: scheme, leafIndex: make(map[string]int, len(hashes))}
+	if len(hashes) == 0 {
+		return mt
 	}
 
 	// Create leaf nodes.
-	var nodes []*MerkleNode
-	for _, tx := range transactions {
-		hash := tx.Hash()
-		nodes = append(nodes, NewMerkleNode(nil, nil, hash))
+	nodes := make([]*MerkleNode, len(hashes))
+	for i := range hashes {
+		nodes[i] = &MerkleNode{Hash: scheme.hashLeaf(hashes[i])}
+		if _, ok := mt.leafIndex[string(nodes[i].Hash)]; !ok {
+			mt.leafIndex[string(nodes[i].Hash)] = i
+		}
 	}
+	mt.Levels = append(mt.Levels, nodes)
 
 	// Build the tree by iteratively hashing pairs of nodes.
 	for len(nodes) > 1 {
-		if len(nodes)%2 != 0 {
-			nodes = append(nodes, nodes[len(nodes)-1]) // Duplicate the last node if odd.
-		}
-
-		var newLevel []*MerkleNode
+		newLevel := make([]*MerkleNode, 0, (len(nodes)+1)/2)
 		for i := 0; i < len(nodes); i += 2 {
-			newNode := NewMerkleNode(nodes[i], nodes[i+1], []byte{})
-			newLevel = append(newLevel, newNode)
+			switch {
+			case i+1 < len(nodes):
+				newLevel = append(newLevel, &MerkleNode{Left: nodes[i], Right: nodes[i+1], Hash: scheme.hashNode(nodes[i].Hash, nodes[i+1].Hash)})
+			case scheme == MerkleSchemeLegacy:
+				// Pair the last node with itself if odd.
+				newLevel = append(newLevel, &MerkleNode{Left: nodes[i], Right: nodes[i], Hash: scheme.hashNode(nodes[i].Hash, nodes[i].Hash)})
+			default:
+				newLevel = append(newLevel, nodes[i]) // Move the last node up unchanged if odd.
+			}
 		}
 		nodes = newLevel
+		mt.Levels = append(mt.Levels, nodes)
 	}
 
 	// The root is the last remaining node.
-	return &MerkleTree{Root: nodes[0], Nodes: nodes}
+	mt.Root = nodes[0]
+	mt.Nodes = nodes
+	return mt
+}
+
+// LeafCount returns the number of leaves in the tree.
+func (mt *MerkleTree) LeafCount() int {
+	if len(mt.Levels) == 0 {
+		return 0
+	}
+	return len(mt.Levels[0])
 }
 
 // CalculateMerkleRoot extracts the Merkle root from the tree.
 func (mt *MerkleTree) CalculateMerkleRoot() []byte {
 	if mt.Root == nil {
-		return []byte{}
+		return nil
 	}
 	return mt.Root.Hash
 }
 
 // GenerateMerkleProof generates a Merkle proof for a given transaction hash.
-func (mt *MerkleTree) GenerateMerkleProof(txHash []byte) ([]byte, bool) {
-	var proof []byte
-	var targetNode *MerkleNode
-
-	// Find the node corresponding to the transaction hash.
-	for _, node := range mt.Nodes {
-		if node.Left == nil && node.Right == nil && bytes.Equal(node.Hash, txHash) {
-			targetNode = node
-			break
-		}
-	}
-
-	if targetNode == nil {
+// If the same transaction hash appears more than once, the proof is for the
+// first occurrence.
+func (mt *MerkleTree) GenerateMerkleProof(txHash []byte) (*MerkleProof, bool) {
+	index, ok := mt.leafIndex[string(mt.Scheme.hashLeaf(txHash))]
+	if !ok {
 		return nil, false // Transaction not found in the tree.
 	}
+	return mt.ProofAt(index)
+}
 
-	// Traverse up the tree to collect proof hashes.
-	currentNode := targetNode
-	for currentNode != mt.Root {
-		parentNode := findParent(mt.Root, currentNode)
-		if parentNode == nil {
-			break
-		}
+// ProofAt generates a Merkle proof for the leaf at index. It takes one
+// sibling from each level, so it runs in O(log n).
+func (mt *MerkleTree) ProofAt(index int) (*MerkleProof, bool) {
+	if index < 0 || index >= mt.LeafCount() {
+		return nil, false
+	}
+	proof := &MerkleProof{Scheme: mt.Scheme, LeafIndex: uint64(index), LeafCount: uint64(mt.LeafCount())}
 
-		if parentNode.Left == currentNode {
-			proof = append(proof, parentNode.Right.Hash...)
-		} else {
-			proof = append(proof, parentNode.Left.Hash...)
+	for _, level := range mt.Levels[:len(mt.Levels)-1] {
+		switch {
+		case index%2 == 1:
+			proof.Siblings = append(proof.Siblings, level[index-1].Hash)
+			proof.Sides = append(proof.Sides, SideLeft)
+		case index+1 < len(level):
+			proof.Siblings = append(proof.Siblings, level[index+1].Hash)
+			proof.Sides = append(proof.Sides, SideRight)
+		case mt.Scheme == MerkleSchemeLegacy:
+			// An odd last node is its own right sibling.
+			proof.Siblings = append(proof.Siblings, level[index].Hash)
+			proof.Sides = append(proof.Sides, SideRight)
+		default:
+			// An odd last node moves up without a sibling.
 		}
-
-		currentNode = parentNode
+		index /= 2
 	}
-
 	return proof, true
 }
 
-// findParent finds the parent of a given node starting from the root.
-func findParent(root, target *MerkleNode) *MerkleNode {
-	if root == nil || root.Left == nil || root.Right == nil {
-		return nil
+// MultiproofAt generates one proof for all leaves at indices. Duplicate
+// indices are ignored.
+func (mt *MerkleTree) MultiproofAt(indices []int) (*MerkleMultiproof, bool) {
+	if len(indices) == 0 {
+		return nil, false
 	}
+	sorted := append([]int(nil), indices...)
+	sort.Ints(sorted)
 
-	if root.Left == target || root.Right == target {
-		return root
-	}
-
-	leftSearch := findParent(root.Left, target)
-	if leftSearch != nil {
-		return leftSearch
+	proof := &MerkleMultiproof{Scheme: mt.Scheme, LeafCount: uint64(mt.LeafCount())}
+	var known []merkleEntry
+	for i, index := range sorted {
+		if index < 0 || index >= mt.LeafCount() {
+			return nil, false
+		}
+		if i > 0 && index == sorted[i-1] {
+			continue
+		}
+		proof.Indices = append(proof.Indices, uint64(index))
+		known = append(known, merkleEntry{uint64(index), mt.Levels[0][index].Hash})
 	}
 
-	return findParent(root.Right, target)
+	walkMultiproof(mt.Scheme, proof.LeafCount, known, func(level int, index uint64) []byte {
+		hash := mt.Levels[level][index].Hash
+		proof.Hashes = append(proof.Hashes, hash)
+		return hash
+	})
+	return proof, true
 }
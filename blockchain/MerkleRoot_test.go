@@ -0,0 +1,138 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// letterHashes returns the SHA-256 of each of the given single bytes.
+func letterHashes(letters string) [][]byte {
+	hashes := make([][]byte, len(letters))
+	for i := range letters {
+		hash := sha256.Sum256([]byte{letters[i]})
+		hashes[i] = hash[:]
+	}
+	return hashes
+}
+
+func TestMerkleRootVectors(t *testing.T) {
+	tests := []struct {
+		leaves string
+		legacy string
+		tagged string
+	}{
+		{"a", "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", "a23bd5b06da9048238a65b3f1d9d0b9e15fae3dde262688e6489aa4c763d1820"},
+		{"ab", "e5a01fee14e0ed5c48714f22180f25ad8365b53f9779f79dc4a3d7e93963f94a", "ad5ca6cddc0b27c6a83e332bf28011769236e6c6a1f786ebf7b5267b37a5bd22"},
+		{"abc", "d31a37ef6ac14a2db1470c4316beb5592e6afd4465022339adafda76a18ffabe", "cac3d448d4e20a2ad5eae1f500e63c2a7f9217cd14572ba7fd22e26dc1ec2648"},
+		{"abcde", "dd14d0ba516bb654a3052b76f051db026f4e322d0be081468fab99440f9e7305", "4dc1abc938a0141a3c7cd1fed88948c35c4452e7e8aff9b1503eb5100a2c77b3"},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			scheme MerkleScheme
+			want   string
+		}{{MerkleSchemeLegacy, tt.legacy}, {MerkleSchemeTagged, tt.tagged}} {
+			root := NewMerkleTreeFromHashes(letterHashes(tt.leaves), c.scheme).CalculateMerkleRoot()
+			if got := hex.EncodeToString(root); got != c.want {
+				t.Errorf("%s root of %q = %s, want %s", c.scheme, tt.leaves, got, c.want)
+			}
+		}
+	}
+}
+
+func TestMerkleRootDuplicatedLastLeaf(t *testing.T) {
+	root := func(leaves string, scheme MerkleScheme) []byte {
+		return NewMerkleTreeFromHashes(letterHashes(leaves), scheme).CalculateMerkleRoot()
+	}
+	if !bytes.Equal(root("abc", MerkleSchemeLegacy), root("abcc", MerkleSchemeLegacy)) {
+		t.Error("legacy roots of abc and abcc differ")
+	}
+	if bytes.Equal(root("abc", MerkleSchemeTagged), root("abcc", MerkleSchemeTagged)) {
+		t.Error("tagged roots of abc and abcc are equal")
+	}
+}
+
+func TestMerkleSchemeFor(t *testing.T) {
+	if got := MerkleSchemeFor(BlockVersion); got != MerkleSchemeTagged {
+		t.Errorf("MerkleSchemeFor(%d) = %s, want %s", BlockVersion, got, MerkleSchemeTagged)
+	}
+	if got := MerkleSchemeFor(3); got != MerkleSchemeLegacy {
+		t.Errorf("MerkleSchemeFor(3) = %s, want %s", got, MerkleSchemeLegacy)
+	}
+}
+
+func TestProofAt(t *testing.T) {
+	for _, scheme := range []MerkleScheme{MerkleSchemeLegacy, MerkleSchemeTagged} {
+		for n := 1; n <= 17; n++ {
+			hashes := benchmarkHashes(n)
+			tree := NewMerkleTreeFromHashes(hashes, scheme)
+			root := tree.CalculateMerkleRoot()
+			for i, hash := range hashes {
+				proof, ok := tree.ProofAt(i)
+				if !ok || !VerifyMerkleProof(root, hash, proof) {
+					t.Fatalf("%s tree of %d leaves: proof of leaf %d does not verify", scheme, n, i)
+				}
+				if byHash, ok := tree.GenerateMerkleProof(hash); !ok || byHash.LeafIndex != uint64(i) {
+					t.Fatalf("%s tree of %d leaves: GenerateMerkleProof does not find leaf %d", scheme, n, i)
+				}
+			}
+			for _, index := range []int{-1, n} {
+				if _, ok := tree.ProofAt(index); ok {
+					t.Fatalf("%s tree of %d leaves: ProofAt(%d) succeeded", scheme, n, index)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateMerkleProofDuplicateLeaf(t *testing.T) {
+	tree := NewMerkleTreeFromHashes(letterHashes("abab"), MerkleSchemeTagged)
+	proof, ok := tree.GenerateMerkleProof(letterHashes("b")[0])
+	if !ok || proof.LeafIndex != 1 {
+		t.Fatalf("GenerateMerkleProof(b) = %v, %v, want the proof of leaf 1", proof, ok)
+	}
+	if _, ok := tree.GenerateMerkleProof(letterHashes("c")[0]); ok {
+		t.Fatal("GenerateMerkleProof found a hash that is not in the tree")
+	}
+}
+
+// benchmarkHashes returns n distinct leaf hashes, standing in for the
+// donations of a large block.
+func benchmarkHashes(n int) [][]byte {
+	hashes := make([][]byte, n)
+	for i := range hashes {
+		hash := sha256.Sum256([]byte{byte(i), byte(i >> 8), byte(i >> 16), byte(i >> 24)})
+		hashes[i] = hash[:]
+	}
+	return hashes
+}
+
+var benchmarkSizes = []struct {
+	name   string
+	leaves int
+}{{"10k", 10_000}, {"100k", 100_000}}
+
+func BenchmarkNewMerkleTree(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		hashes := benchmarkHashes(size.leaves)
+		b.Run(size.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				NewMerkleTreeFromHashes(hashes, MerkleSchemeTagged)
+			}
+		})
+	}
+}
+
+func BenchmarkProofAt(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		tree := NewMerkleTreeFromHashes(benchmarkHashes(size.leaves), MerkleSchemeTagged)
+		b.Run(size.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, ok := tree.ProofAt(i % size.leaves); !ok {
+					b.Fatal("ProofAt failed")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AmountDecimals is the number of decimal places an Amount carries.
+const AmountDecimals = 2
+
+// amountScale is 10^AmountDecimals, the number of smallest units in one
+// whole unit of currency.
+const amountScale = 100
+
+var (
+	ErrAmountOverflow  = errors.New("amount overflow")
+	ErrAmountUnderflow = errors.New("amount underflow")
+	ErrInvalidAmount   = errors.New("invalid amount")
+)
+
+// Amount is a monetary value counted in the smallest unit of the currency
+// (paise), so 12.50 is stored as 1250. Being an integer it represents every
+// value exactly and never accumulates rounding errors in totals.
+type Amount uint64
+
+// NewAmount builds an Amount from whole units and a fractional part in
+// smallest units, e.g. NewAmount(12, 50) is 12.50.
+func NewAmount(units uint64, fraction uint64) (Amount, error) {
+	if fraction >= amountScale || units > (math.MaxUint64-fraction)/amountScale {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(units*amountScale + fraction), nil
+}
+
+// ParseAmount parses a decimal string such as "12", "12.5" or "12.50".
+// Values with more than AmountDecimals decimal places are rejected instead
+// of being rounded.
+func ParseAmount(s string) (Amount, error) {
+	whole, fraction, hasPoint := strings.Cut(s, ".")
+	if whole == "" || (hasPoint && fraction == "") || len(fraction) > AmountDecimals {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if strings.ContainsAny(whole, "+-") || strings.ContainsAny(fraction, "+-") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	units, err := strconv.ParseUint(whole, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, ErrAmountOverflow
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	var frac uint64
+	if fraction != "" {
+		fraction += strings.Repeat("0", AmountDecimals-len(fraction))
+		if frac, err = strconv.ParseUint(fraction, 10, 64); err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+		}
+	}
+	return NewAmount(units, frac)
+}
+
+// AmountFromFloat converts a legacy floating point value to an Amount by
+// rounding it to the nearest smallest unit. It exists to read values written
+// while they were still float32, such as the JSON numbers sent by older
+// clients (see Amount.UnmarshalJSON).
+func AmountFromFloat(f float64) (Amount, error) {
+	if math.IsNaN(f) || f < 0 {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidAmount, f)
+	}
+	scaled := math.Round(f * amountScale)
+	if scaled >= math.MaxUint64 {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(scaled), nil
+}
+
+// String formats the amount with exactly AmountDecimals decimal places.
+func (a Amount) String() string {
+	return fmt.Sprintf("%d.%0*d", uint64(a)/amountScale, AmountDecimals, uint64(a)%amountScale)
+}
+
+// Add returns a+b or ErrAmountOverflow.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a > math.MaxUint64-b {
+		return 0, ErrAmountOverflow
+	}
+	return a + b, nil
+}
+
+// Sub returns a-b or ErrAmountUnderflow if b is larger than a.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, ErrAmountUnderflow
+	}
+	return a - b, nil
+}
+
+// MarshalJSON encodes the amount as a decimal string so that no precision is
+// lost in clients that read JSON numbers as floats.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts the decimal string written by MarshalJSON as well as
+// a plain JSON number, which is how values were written before Amount
+// existed.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := ParseAmount(s)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	}
+
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAmount, data)
+	}
+	parsed, err := AmountFromFloat(f)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
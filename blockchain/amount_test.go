@@ -0,0 +1,111 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{"12", 1200, nil},
+		{"12.5", 1250, nil},
+		{"12.50", 1250, nil},
+		{"0.01", 1, nil},
+		{"007.10", 710, nil},
+		{"184467440737095516.15", math.MaxUint64, nil},
+		{"12.505", 0, ErrInvalidAmount},
+		{"0.001", 0, ErrInvalidAmount},
+		{"-1", 0, ErrInvalidAmount},
+		{"-0.50", 0, ErrInvalidAmount},
+		{"+1", 0, ErrInvalidAmount},
+		{"1.-5", 0, ErrInvalidAmount},
+		{"", 0, ErrInvalidAmount},
+		{".5", 0, ErrInvalidAmount},
+		{"5.", 0, ErrInvalidAmount},
+		{"1e3", 0, ErrInvalidAmount},
+		{"184467440737095516.16", 0, ErrAmountOverflow},
+		{"18446744073709551616", 0, ErrAmountOverflow},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, %v; want %d, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestAmountFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Amount
+		err  error
+	}{
+		{12.5, 1250, nil},
+		{float64(float32(0.1)), 10, nil},
+		{float64(float32(1234.56)), 123456, nil},
+		{0, 0, nil},
+		{-0.01, 0, ErrInvalidAmount},
+		{math.NaN(), 0, ErrInvalidAmount},
+		{math.Inf(1), 0, ErrAmountOverflow},
+		{1e18, 0, ErrAmountOverflow},
+	}
+	for _, tt := range tests {
+		got, err := AmountFromFloat(tt.in)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("AmountFromFloat(%v) = %d, %v; want %d, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{`"12.50"`, 1250, nil},
+		{`"0"`, 0, nil},
+		// Values written while they were float32 are plain numbers.
+		{`12.5`, 1250, nil},
+		{`0.1`, 10, nil},
+		{`"12.505"`, 0, ErrInvalidAmount},
+		{`"-1"`, 0, ErrInvalidAmount},
+		{`-1`, 0, ErrInvalidAmount},
+		{`1e30`, 0, ErrAmountOverflow},
+		{`"18446744073709551616"`, 0, ErrAmountOverflow},
+		{`true`, 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		var got Amount
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+
+	data, err := json.Marshal(Amount(1205))
+	if err != nil || string(data) != `"12.05"` {
+		t.Fatalf("Marshal(1205) = %s, %v; want \"12.05\"", data, err)
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	if _, err := Amount(math.MaxUint64).Add(1); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("MaxUint64 + 1: got %v, want %v", err, ErrAmountOverflow)
+	}
+	if _, err := Amount(1).Sub(2); !errors.Is(err, ErrAmountUnderflow) {
+		t.Errorf("1 - 2: got %v, want %v", err, ErrAmountUnderflow)
+	}
+	if got, err := Amount(1250).Sub(1249); err != nil || got != 1 {
+		t.Errorf("1250 - 1249 = %d, %v; want 1", got, err)
+	}
+	if _, err := NewAmount(1, amountScale); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("NewAmount(1, %d): got %v, want %v", amountScale, err, ErrAmountOverflow)
+	}
+}
@@ -1,78 +1,141 @@
 package blockchain
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
 	"time"
 )
+
 const (
 	GENESIS_STRING = "THIS IS THE FIRST BLOCK"
 )
+
+// BlockVersion is the header version of blocks created by this code. It is
+// the first field of the header encoding and decides which fields follow it.
+// Every change to the header bumps it, and only the current version is
+// accepted.
+//
+//	1  original header
+//	2  adds the authority vote
+//	3  seals with a fixed-size, low-S wallet.Signature instead of ASN.1
+//	4  commits to transactions with a MerkleSchemeTagged tree
+//	5  commits to the state after the block in StateRoot
+//	6  commits to the transaction receipts in ReceiptsRoot; transactions
+//	   that are valid but cannot be carried out are included with a failed
+//	   receipt
+const BlockVersion uint32 = 6
+
 func init() {
 	log.SetPrefix("Blockchain: ")
 }
 
-type Block struct {
+// BlockHeader holds every consensus field of a block. Its hash is the block
+// ID, and since the transactions are committed to through MerkleRoot a
+// header can be synced, stored and verified without the block body.
+type BlockHeader struct {
+	Version      uint32
+	Height       uint64
 	PreviousHash []byte
+	MerkleRoot   []byte
+	StateRoot    []byte
+	// ReceiptsRoot is the root of a MerkleSchemeTagged tree over the hashes
+	// of the block's receipts, in transaction order.
+	ReceiptsRoot []byte
 	Timestamp    uint64
-	BlockHash []byte
-	Height uint64
+	Proposer     string
+	// VoteCandidate is the public key of an authority the proposer votes
+	// to add (VoteAuthorize) or revoke. Empty when the block carries no vote.
+	VoteCandidate []byte
+	VoteAuthorize bool
+	Signature     []byte
+}
+
+// Hash returns the SHA-256 of the canonical header encoding, which is the
+// ID of the block.
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(EncodeBlockHeader(h))
+	return hash[:]
+}
+
+// SealHash returns the hash an authority signs: the canonical encoding of
+// every header field except the signature itself.
+func (h *BlockHeader) SealHash() []byte {
+	hash := sha256.Sum256(encodeBlockHeader(h, kindBlockSealing))
+	return hash[:]
+}
+
+func (h *BlockHeader) Print() {
+	fmt.Printf("Height:          %d\n", h.Height)
+	fmt.Printf("Timestamp:       %d\n", h.Timestamp)
+	fmt.Printf("Previous Hash:   %x\n", h.PreviousHash)
+	fmt.Printf("Merkle Root:     %x\n", h.MerkleRoot)
+	fmt.Printf("State Root:      %x\n", h.StateRoot)
+	fmt.Printf("Receipts Root:   %x\n", h.ReceiptsRoot)
+	fmt.Printf("Proposer:        %s\n", h.Proposer)
+}
+
+type Block struct {
+	Header       BlockHeader
 	Transactions []Transactions
-	MerkleRoot   []byte
-	Signature	string
-	TxMerkleTree *MerkleTree
 }
 
 func NewBlock(previousHash []byte, transactions []Transactions) *Block {
 	b := new(Block)
-	b.Timestamp = uint64(time.Now().UnixNano())
-	b.PreviousHash = previousHash
+	b.Header.Version = BlockVersion
+	b.Header.Timestamp = uint64(time.Now().UnixNano())
+	b.Header.PreviousHash = previousHash
 	b.Transactions = transactions
-	merkleTree := NewMerkleTree(transactions)
-	b.MerkleRoot = merkleTree.CalculateMerkleRoot()
+	b.Header.MerkleRoot = b.MerkleTree().CalculateMerkleRoot()
 	return b
 }
 
-
 func (b *Block) Print() {
-	fmt.Printf("Timestamp:       %d\n", b.Timestamp)
-	fmt.Printf("Previous Hash:   %x\n", b.PreviousHash)
-	fmt.Printf("Merkle Root:     %x\n", b.MerkleRoot)
+	b.Header.Print()
 	for _, t := range b.Transactions {
 		t.Print()
 	}
 }
 
+// Hash returns the ID of the block, the hash of its header.
 func (b *Block) Hash() []byte {
-	m, err := json.Marshal(b)
-	if err != nil {
-		fmt.Println("Error while marshalling!!!")
+	return b.Header.Hash()
+}
+
+// MerkleTree builds the Merkle tree over the block's transactions, using the
+// scheme of the block's version.
+func (b *Block) MerkleTree() *MerkleTree {
+	return NewMerkleTreeWithScheme(b.Transactions, MerkleSchemeFor(b.Header.Version))
+}
+
+// TransactionProof returns a Merkle proof that the transaction with the given
+// ID is in b. It verifies against b.Header.MerkleRoot with the transaction's
+// Hash as the leaf.
+func (b *Block) TransactionProof(id []byte) (*MerkleProof, bool) {
+	for i := range b.Transactions {
+		if bytes.Equal(b.Transactions[i].ID(), id) {
+			return b.MerkleTree().GenerateMerkleProof(b.Transactions[i].Hash())
+		}
 	}
-	fmt.Println(string(m))
-	hash := sha256.Sum256(m)
-	return hash[:]
+	return nil, false
 }
 
 func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Timestamp    uint64          `json:"timestamp"`
-		PreviousHash []byte       `json:"previous_hash"`
-		MerkleRoot   []byte       `json:"merkle_root"`
+		Height       uint64         `json:"height"`
+		Timestamp    uint64         `json:"timestamp"`
+		PreviousHash []byte         `json:"previous_hash"`
+		MerkleRoot   []byte         `json:"merkle_root"`
+		Proposer     string         `json:"proposer"`
 		Transactions []Transactions `json:"transactions"`
 	}{
-		Timestamp:    b.Timestamp,
-		PreviousHash: b.PreviousHash,
-		MerkleRoot:   b.MerkleRoot,
+		Height:       b.Header.Height,
+		Timestamp:    b.Header.Timestamp,
+		PreviousHash: b.Header.PreviousHash,
+		MerkleRoot:   b.Header.MerkleRoot,
+		Proposer:     b.Header.Proposer,
 		Transactions: b.Transactions,
 	})
 }
-
-func (b *Block) AddTxToBlock(txPool []Transactions) error {
-	var tree *MerkleTree
-	tree = NewMerkleTree(txPool)
-	b.TxMerkleTree = tree 
-	return nil
-}
-
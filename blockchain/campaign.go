@@ -0,0 +1,358 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// Reasons a campaign transaction cannot be carried out. Such a transaction
+// is included with a failed receipt, see ExecuteBlock.
+var (
+	ErrUnknownCampaign  = errors.New("campaign does not exist")
+	ErrCampaignDeadline = errors.New("campaign deadline has passed")
+	ErrCampaignPaidOut  = errors.New("campaign has released all its milestones")
+	ErrNotCampaignOwner = errors.New("sender does not own the campaign")
+	ErrGoalNotReached   = errors.New("campaign has not reached its goal")
+	ErrMilestoneOrder   = errors.New("milestone is not the next to be released")
+	ErrNotRefundable    = errors.New("campaign is not refundable")
+	ErrNothingToRefund  = errors.New("sender has no donations to refund")
+)
+
+// Campaign is a fundraiser held on the chain. Donations are kept by the
+// campaign and paid out to the beneficiary milestone by milestone once the
+// goal is reached. If the deadline passes first, donors can take their
+// donations back.
+type Campaign struct {
+	// ID is the ID of the transaction that created the campaign.
+	ID []byte
+	// Owner is the address that created the campaign and releases its
+	// milestones.
+	Owner           []byte
+	Beneficiary     []byte
+	Goal            Amount
+	Deadline        uint64
+	DescriptionHash []byte
+	Milestones      []Amount
+	// Raised is what donors have given, less what was refunded, and
+	// Withdrawn what has been paid out to the beneficiary.
+	Raised    Amount
+	Withdrawn Amount
+	// Released is the number of milestones paid out.
+	Released uint32
+
+	// contributions is what each donor has given, less refunds.
+	contributions map[string]Amount
+}
+
+func (c *Campaign) copy() *Campaign {
+	next := *c
+	next.contributions = make(map[string]Amount, len(c.contributions))
+	for donor, amount := range c.contributions {
+		next.contributions[donor] = amount
+	}
+	return &next
+}
+
+// CampaignStatus is where a campaign stands.
+type CampaignStatus string
+
+const (
+	// CampaignActive takes donations: its deadline has not passed and it
+	// has not reached its goal.
+	CampaignActive CampaignStatus = "active"
+	// CampaignFunded has reached its goal and is paying out its milestones.
+	// It takes donations until its deadline or its last milestone.
+	CampaignFunded CampaignStatus = "funded"
+	// CampaignCompleted has paid out every milestone.
+	CampaignCompleted CampaignStatus = "completed"
+	// CampaignFailed missed its goal by the deadline. Donors can take their
+	// donations back.
+	CampaignFailed CampaignStatus = "failed"
+)
+
+// Status returns the status of the campaign at time, a block time in Unix
+// nanoseconds. A campaign fails when its deadline passes, without any
+// transaction marking it, so the status is worked out from the campaign and
+// the time rather than stored.
+func (c *Campaign) Status(time uint64) CampaignStatus {
+	switch {
+	case int(c.Released) == len(c.Milestones):
+		return CampaignCompleted
+	case c.Raised >= c.Goal:
+		return CampaignFunded
+	case time < c.Deadline:
+		return CampaignActive
+	default:
+		return CampaignFailed
+	}
+}
+
+// Contribution returns what donor has given the campaign, less refunds.
+func (c *Campaign) Contribution(donor []byte) Amount {
+	return c.contributions[string(donor)]
+}
+
+// DonorCount returns the number of donors whose donations the campaign
+// holds or has paid out. Donors who took their donations back are not
+// counted.
+func (c *Campaign) DonorCount() int {
+	return len(c.contributions)
+}
+
+// CampaignContribution is what one donor has given a campaign.
+type CampaignContribution struct {
+	Donor  []byte
+	Amount Amount
+}
+
+// Contributions returns what every donor has given the campaign, largest
+// first and by address among equals.
+func (c *Campaign) Contributions() []CampaignContribution {
+	contributions := make([]CampaignContribution, 0, len(c.contributions))
+	for donor, amount := range c.contributions {
+		contributions = append(contributions, CampaignContribution{[]byte(donor), amount})
+	}
+	sort.Slice(contributions, func(i, j int) bool {
+		if contributions[i].Amount != contributions[j].Amount {
+			return contributions[i].Amount > contributions[j].Amount
+		}
+		return bytes.Compare(contributions[i].Donor, contributions[j].Donor) < 0
+	})
+	return contributions
+}
+
+// CampaignKey returns the key a Campaign is stored under in the state tree.
+func CampaignKey(id []byte) []byte {
+	return append([]byte("campaign:"), id...)
+}
+
+// ContributionKey returns the key what donor has given the campaign with the
+// given ID is stored under in the state tree. Campaign IDs have a fixed
+// length, so the key names exactly one campaign and donor.
+func ContributionKey(id []byte, donor []byte) []byte {
+	return append(append([]byte("contribution:"), id...), donor...)
+}
+
+// campaign returns the campaign with the given ID.
+func (s *State) campaign(id []byte) (*Campaign, error) {
+	c, ok := s.campaigns[string(id)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %x", ErrUnknownCampaign, id)
+	}
+	return c, nil
+}
+
+// Campaign returns the campaign with the given ID. The campaign must not be
+// modified.
+func (s *State) Campaign(id []byte) (*Campaign, bool) {
+	c, ok := s.campaigns[string(id)]
+	return c, ok
+}
+
+// Campaigns returns every campaign, by ID.
+func (s *State) Campaigns() []*Campaign {
+	campaigns := make([]*Campaign, 0, len(s.campaigns))
+	for _, c := range s.campaigns {
+		campaigns = append(campaigns, c)
+	}
+	sort.Slice(campaigns, func(i, j int) bool { return bytes.Compare(campaigns[i].ID, campaigns[j].ID) < 0 })
+	return campaigns
+}
+
+// ProveContribution returns what donor has given the campaign with the given
+// ID together with a proof of it against Root. If donor has given nothing
+// the proof shows the contribution is absent.
+func (s *State) ProveContribution(id []byte, donor []byte) (Amount, *StateProof) {
+	var amount Amount
+	if c, ok := s.campaigns[string(id)]; ok {
+		amount = c.Contribution(donor)
+	}
+	return amount, s.Tree().Prove(ContributionKey(id, donor))
+}
+
+// VerifyContributionProof reports whether proof shows that donor has given
+// amount to the campaign with the given ID in the state with the given root.
+func VerifyContributionProof(root []byte, id []byte, donor []byte, amount Amount, proof *StateProof) bool {
+	var value []byte
+	if amount != 0 {
+		value = EncodeContribution(amount)
+	}
+	return VerifyStateProof(root, ContributionKey(id, donor), value, proof)
+}
+
+// Campaign returns the campaign with the given ID at the head of the chain.
+func (bc *Blockchain) Campaign(id []byte) (*Campaign, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.state.Campaign(id)
+}
+
+// Campaigns returns every campaign at the head of the chain, by ID.
+func (bc *Blockchain) Campaigns() []*Campaign {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.state.Campaigns()
+}
+
+// CampaignStatus returns the status of c as of the head block.
+func (bc *Blockchain) CampaignStatus(c *Campaign) CampaignStatus {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return c.Status(bc.lastBlock().Header.Timestamp)
+}
+
+// ProveContribution returns what donor has given the campaign with the given
+// ID at the head of the chain, with a proof of it against the head's
+// StateRoot.
+func (bc *Blockchain) ProveContribution(id []byte, donor []byte) (Amount, *StateProof) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.state.ProveContribution(id, donor)
+}
+
+// addCampaigns adds every campaign and contribution to tree.
+func (s *State) addCampaigns(tree *StateTree) {
+	for _, c := range s.campaigns {
+		tree.Set(CampaignKey(c.ID), EncodeCampaign(c))
+		for donor, amount := range c.contributions {
+			tree.Set(ContributionKey(c.ID, []byte(donor)), EncodeContribution(amount))
+		}
+	}
+}
+
+func (p *CreateCampaignPayload) apply(s *State, tx *Transactions, h *BlockHeader) ([]Event, error) {
+	if h.Timestamp >= p.Deadline {
+		return nil, ErrCampaignDeadline
+	}
+	c := &Campaign{
+		ID:              tx.ID(),
+		Owner:           tx.SenderHash,
+		Beneficiary:     p.Beneficiary,
+		Goal:            p.Goal,
+		Deadline:        p.Deadline,
+		DescriptionHash: p.DescriptionHash,
+		Milestones:      p.Milestones,
+		contributions:   make(map[string]Amount),
+	}
+	s.campaigns[string(c.ID)] = c
+	return []Event{{Type: "create-campaign", Attributes: []EventAttribute{
+		campaignAttribute(c.ID),
+		{"owner", wallet.AddressFromPubKeyHash(c.Owner)},
+		{"beneficiary", wallet.AddressFromPubKeyHash(c.Beneficiary)},
+		{"goal", c.Goal.String()},
+	}}}, nil
+}
+
+// apply checks the sender's funds first: a donor who cannot pay sends an
+// invalid transaction, whatever the state of the campaign.
+func (p *DonatePayload) apply(s *State, tx *Transactions, h *BlockHeader) ([]Event, error) {
+	balance := s.balances[string(tx.SenderHash)]
+	debited, err := balance.Sub(tx.Value)
+	if err != nil {
+		return nil, insufficientFunds(tx, balance)
+	}
+	c, err := s.campaign(p.CampaignID)
+	if err != nil {
+		return nil, err
+	}
+	if h.Timestamp >= c.Deadline {
+		return nil, ErrCampaignDeadline
+	}
+	if int(c.Released) == len(c.Milestones) {
+		return nil, ErrCampaignPaidOut
+	}
+	raised, err := c.Raised.Add(tx.Value)
+	if err != nil {
+		return nil, err
+	}
+	contribution, err := c.contributions[string(tx.SenderHash)].Add(tx.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	c = c.copy()
+	c.Raised = raised
+	c.contributions[string(tx.SenderHash)] = contribution
+	s.campaigns[string(c.ID)] = c
+	s.balances[string(tx.SenderHash)] = debited
+	return []Event{{Type: "donate", Attributes: []EventAttribute{
+		campaignAttribute(c.ID),
+		{"donor", wallet.AddressFromPubKeyHash(tx.SenderHash)},
+		{"value", tx.Value.String()},
+	}}}, nil
+}
+
+// apply pays out the next milestone. The last milestone also pays out
+// anything raised beyond the goal.
+func (p *ReleaseFundsPayload) apply(s *State, tx *Transactions, h *BlockHeader) ([]Event, error) {
+	c, err := s.campaign(p.CampaignID)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tx.SenderHash, c.Owner) {
+		return nil, ErrNotCampaignOwner
+	}
+	if c.Raised < c.Goal {
+		return nil, fmt.Errorf("%w: raised %s of %s", ErrGoalNotReached, c.Raised, c.Goal)
+	}
+	if p.Milestone != c.Released || int(p.Milestone) >= len(c.Milestones) {
+		return nil, fmt.Errorf("%w: released %d of %d, got %d", ErrMilestoneOrder, c.Released, len(c.Milestones), p.Milestone)
+	}
+	amount := c.Milestones[p.Milestone]
+	if int(p.Milestone) == len(c.Milestones)-1 {
+		amount = c.Raised - c.Withdrawn
+	}
+	credited, err := s.balances[string(c.Beneficiary)].Add(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	c = c.copy()
+	c.Withdrawn += amount
+	c.Released++
+	s.campaigns[string(c.ID)] = c
+	s.balances[string(c.Beneficiary)] = credited
+	return []Event{{Type: "release-funds", Attributes: []EventAttribute{
+		campaignAttribute(c.ID),
+		{"milestone", strconv.FormatUint(uint64(p.Milestone), 10)},
+		{"to", wallet.AddressFromPubKeyHash(c.Beneficiary)},
+		{"value", amount.String()},
+	}}}, nil
+}
+
+// apply returns the sender's donations once the campaign's deadline has
+// passed without it reaching its goal. Nothing has been paid out of such a
+// campaign, so every donation is still there to be returned.
+func (p *RefundPayload) apply(s *State, tx *Transactions, h *BlockHeader) ([]Event, error) {
+	c, err := s.campaign(p.CampaignID)
+	if err != nil {
+		return nil, err
+	}
+	if h.Timestamp < c.Deadline || c.Raised >= c.Goal {
+		return nil, ErrNotRefundable
+	}
+	contribution := c.contributions[string(tx.SenderHash)]
+	if contribution == 0 {
+		return nil, ErrNothingToRefund
+	}
+	credited, err := s.balances[string(tx.SenderHash)].Add(contribution)
+	if err != nil {
+		return nil, err
+	}
+
+	c = c.copy()
+	c.Raised -= contribution
+	delete(c.contributions, string(tx.SenderHash))
+	s.campaigns[string(c.ID)] = c
+	s.balances[string(tx.SenderHash)] = credited
+	return []Event{{Type: "refund", Attributes: []EventAttribute{
+		campaignAttribute(c.ID),
+		{"to", wallet.AddressFromPubKeyHash(tx.SenderHash)},
+		{"value", contribution.String()},
+	}}}, nil
+}
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCampaignStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		raised   Amount
+		released uint32
+		time     uint64
+		want     CampaignStatus
+	}{
+		{"before the deadline", 5, 0, 50, CampaignActive},
+		{"deadline passed short of the goal", 5, 0, 100, CampaignFailed},
+		{"goal reached", 10, 0, 50, CampaignFunded},
+		{"goal reached before the deadline passed", 10, 1, 200, CampaignFunded},
+		{"every milestone paid out", 10, 2, 50, CampaignCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Campaign{Goal: 10, Deadline: 100, Milestones: []Amount{4, 6}, Raised: tt.raised, Released: tt.released}
+			if got := c.Status(tt.time); got != tt.want {
+				t.Fatalf("Status = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCampaignContributions(t *testing.T) {
+	bc := newFundedChain(t)
+	createBlock(t, bc, signedTransfer(t, aliceWallet, 0, bob, 4*amountScale))
+	create := typed(t, bobWallet, 0, newCampaignPayload(time.Now().Add(time.Hour), 10*amountScale), 0)
+	id := create.ID()
+	createBlock(t, bc,
+		create,
+		typed(t, aliceWallet, 1, &DonatePayload{CampaignID: id}, 3*amountScale),
+		typed(t, bobWallet, 1, &DonatePayload{CampaignID: id}, 3*amountScale),
+		typed(t, aliceWallet, 2, &DonatePayload{CampaignID: id}, amountScale),
+	)
+
+	c, ok := bc.Campaign(id)
+	if !ok {
+		t.Fatal("campaign not found")
+	}
+	if campaigns := bc.Campaigns(); len(campaigns) != 1 || !bytes.Equal(campaigns[0].ID, id) {
+		t.Fatalf("Campaigns returned %d campaigns, want the one created", len(campaigns))
+	}
+	if c.Raised != 7*amountScale || c.DonorCount() != 2 || bc.CampaignStatus(c) != CampaignActive {
+		t.Fatalf("campaign raised %s from %d donors and is %s, want 7.00 from 2 and active", c.Raised, c.DonorCount(), bc.CampaignStatus(c))
+	}
+	want := []CampaignContribution{{alice, 4 * amountScale}, {bob, 3 * amountScale}}
+	if got := c.Contributions(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Contributions = %v, want %v", got, want)
+	}
+	if got := c.Contribution(carol); got != 0 {
+		t.Fatalf("Contribution of a stranger = %s, want 0.00", got)
+	}
+
+	root := bc.LastBlock().Header.StateRoot
+	amount, proof := bc.ProveContribution(id, alice)
+	if amount != 4*amountScale || !VerifyContributionProof(root, id, alice, amount, proof) {
+		t.Fatalf("ProveContribution = %s with a proof that does not verify, want 4.00", amount)
+	}
+	if VerifyContributionProof(root, id, alice, amount+1, proof) {
+		t.Fatal("proof verifies another amount")
+	}
+	amount, proof = bc.ProveContribution(id, carol)
+	if amount != 0 || !VerifyContributionProof(root, id, carol, 0, proof) {
+		t.Fatalf("ProveContribution of a stranger = %s with a proof that does not verify, want 0.00", amount)
+	}
+}
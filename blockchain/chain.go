@@ -1,31 +1,226 @@
 package blockchain
 
-import(
+import (
+	"bytes"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/Roshan310/DaanVeer/mempool"
+	"github.com/Roshan310/DaanVeer/wallet"
 )
+
+var ErrNoSealer = errors.New("consensus is set but there is no sealer wallet")
+
+// Blockchain is safe for concurrent use through its methods: the ones that
+// change the chain hold its lock exclusively and the ones that read it share
+// it.
 type Blockchain struct {
-	TransactionPool []Transactions
-	Chain           []*Block
+	// Pool holds the transactions waiting to be put into a block. Use
+	// SetPoolConfig to change its limits, and AddTransaction and Mint to add
+	// to it, since the pool checks balances against the chain.
+	Pool *mempool.Mempool
+	// Chain is the canonical chain, from genesis to the head. Blocks on side
+	// branches are only kept in the store until their branch becomes the
+	// heaviest, see AddBlock. While the chain is in use concurrently, read
+	// it through LastBlock and BlockByHeight instead.
+	Chain []*Block
+	// ChainID names this network. Transactions must carry it to be accepted.
+	ChainID string
+	// Consensus, when set, is used to check that every block after genesis
+	// was signed by an authority. NewBlockchain takes it from the genesis
+	// spec; replace it with SetConsensus, which checks the stored finality
+	// certificate against the new authorities.
+	Consensus *PoA
+	// Sealer is the authority wallet CreateBlock signs new blocks with. It
+	// is required whenever Consensus is set.
+	Sealer *wallet.Wallet
+	// mu guards Chain and the fields below. Exported methods take it;
+	// unexported ones expect the caller to hold it.
+	mu    sync.RWMutex
+	store BlockStore
+	state *State
+	// undo holds, for every block of Chain, what it changed in the state,
+	// so a reorganisation can step back to the fork point.
+	undo []stateUndo
+	// cacheMu guards snapshots and weights, which readers fill in too while
+	// sharing mu. snapshots caches the PoA snapshot after each block, by
+	// block hash, and weights the total weight of the chain ending at each
+	// block.
+	cacheMu   sync.Mutex
+	snapshots map[string]*Snapshot
+	weights   map[string]uint64
+	// invalid holds the blocks that failed to apply when their branch was
+	// chosen.
+	invalid map[string]error
+	// reorgSubscribers are called with the reorgs of a call once it has
+	// unlocked the chain, see unlock.
+	reorgSubscribers []func(ReorgEvent)
+	reorgs           []ReorgEvent
+	// precommits collects the precommits for blocks above the finalized
+	// height, by block hash and authority, and finalized is the
+	// certificate of the latest finalized block.
+	precommits map[string]map[string]*Precommit
+	finalized  *FinalityCertificate
+	index      *chainIndex
 }
 
-func NewBlockchain() *Blockchain {
-	b := &Block{}
-	bc := new(Blockchain)
-	bc.CreateBlock(b.Hash()) // Genesis block
-	return bc
+// NewBlockchain opens the chain kept in store for the network described by
+// genesis. If the store is empty the genesis block is built from the spec,
+// otherwise the existing chain is loaded and its genesis block must match
+// the spec. The chain ID and, if the spec lists authorities, the consensus
+// engine are taken from the spec. A nil spec is the empty spec: no chain ID,
+// no authorities and no initial balances; with a nil spec an existing store
+// is opened whatever its genesis block.
+func NewBlockchain(store BlockStore, genesis *Genesis) (*Blockchain, error) {
+	bc := &Blockchain{
+		store:      store,
+		state:      NewState(),
+		snapshots:  make(map[string]*Snapshot),
+		weights:    make(map[string]uint64),
+		invalid:    make(map[string]error),
+		precommits: make(map[string]map[string]*Precommit),
+		index:      newChainIndex(),
+	}
+	bc.SetPoolConfig(mempool.DefaultConfig)
+	check := genesis != nil
+	if genesis == nil {
+		genesis = &Genesis{}
+	}
+	bc.ChainID = genesis.ChainID
+	bc.Consensus = genesis.PoA()
+	g, err := genesis.Block()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = store.Head()
+	if errors.Is(err, ErrBlockNotFound) {
+		state := bc.state.Copy()
+		receipts, err := state.ExecuteBlock(g)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.PutBlock(g); err != nil {
+			return nil, err
+		}
+		if err := store.PutReceipts(g.Hash(), receipts); err != nil {
+			return nil, err
+		}
+		if err := store.SetHead(g.Hash()); err != nil {
+			return nil, err
+		}
+		bc.appendCanonical(g, bc.state.undoTo(state))
+		bc.state = state
+		return bc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.Iterate(func(b *Block) error {
+		state := bc.state.Copy()
+		if err := state.ApplyBlock(b); err != nil {
+			return err
+		}
+		bc.appendCanonical(b, bc.state.undoTo(state))
+		bc.state = state
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chain: %w", err)
+	}
+	if check && !bytes.Equal(bc.Chain[0].Hash(), g.Hash()) {
+		return nil, fmt.Errorf("%w: stored %x, spec %x", ErrGenesisMismatch, bc.Chain[0].Hash(), g.Hash())
+	}
+	if err := bc.loadFinality(); err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
+// Close closes the underlying block store.
+func (bc *Blockchain) Close() error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.store.Close()
 }
 
 func (bc *Blockchain) LastBlock() *Block {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.lastBlock()
+}
+
+func (bc *Blockchain) lastBlock() *Block {
 	return bc.Chain[len(bc.Chain)-1]
 }
 
-func (bc *Blockchain) AddTransaction(sender []byte, recipient []byte, value float32) {
-	t := NewTransaction(sender, recipient, value)
-	bc.TransactionPool = append(bc.TransactionPool, *t)
+// AddTransaction puts a transaction into the pool. It is rejected if it is
+// not of the current TransactionVersion or not meant for this chain, if it
+// breaks the rules of its kind (see CheckPayload), if it does not verify, if
+// it is already pooled, if it does not carry the sender's next nonce (see
+// NextNonce) or if the sender cannot afford it on top of what they already
+// have pending in the pool. An authority vote must also be from an authority
+// and change something at the head of the chain.
+func (bc *Blockchain) AddTransaction(tx *Transactions) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if tx.IsMint() {
+		return ErrMissingSender
+	}
+	if tx.Version != TransactionVersion {
+		return ErrTransactionVersion
+	}
+	if tx.ChainID != bc.ChainID {
+		return ErrWrongChain
+	}
+	if tx.Kind == TxAuthorityVote {
+		snap, err := bc.snapshot(bc.lastBlock().Hash())
+		if err != nil {
+			return err
+		}
+		if err := snap.copy().castTx(tx); err != nil {
+			return fmt.Errorf("%w: %v", ErrBadVote, err)
+		}
+	}
+	return bc.Pool.Add(newPoolTx(tx))
+}
+
+// Mint puts a transaction into the pool that credits recipient with new
+// funds. It is meant to be called by the node of an authority recording a
+// deposit, and does no authentication of its own: it must not be exposed to
+// anyone else. A block holding a mint is only valid when it is signed by an
+// authority, so Mint fails with ErrUnsealedMint on a chain without consensus.
+func (bc *Blockchain) Mint(recipient []byte, value Amount) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if bc.Consensus == nil {
+		return ErrUnsealedMint
+	}
+	return bc.Pool.Add(newPoolTx(NewTransaction(bc.ChainID, 0, nil, recipient, value)))
+}
+
+// ProveAccount returns the account of address at the head of the chain
+// together with a proof of it against the head's StateRoot.
+func (bc *Blockchain) ProveAccount(address []byte) (Account, *StateProof) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.state.ProveAccount(address)
+}
+
+// BalanceOf returns the balance of address at the head of the chain.
+func (bc *Blockchain) BalanceOf(address []byte) Amount {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.state.BalanceOf(address)
 }
 
 func (bc *Blockchain) Print() {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
 	for i, block := range bc.Chain {
 		fmt.Printf("%s Chain %d %s\n", strings.Repeat("=", 25), i, strings.Repeat("=", 25))
 		block.Print()
@@ -33,9 +228,200 @@ func (bc *Blockchain) Print() {
 	fmt.Printf("%s\n", strings.Repeat("*", 25))
 }
 
-func (bc *Blockchain) CreateBlock(previousHash []byte) *Block {
-	b := NewBlock(previousHash, bc.TransactionPool)
-	bc.Chain = append(bc.Chain, b)
-	bc.TransactionPool = []Transactions{}
-	return b
-}
\ No newline at end of file
+// AddBlock validates a block received from elsewhere and adds it to the
+// chain. A block on top of the head is appended to the chain and its
+// transactions are removed from the local pool. A block on top of any other
+// known block starts or extends a side branch, and if that branch is now
+// heavier than the canonical chain the chain is reorganised onto it (see
+// Weight and SubscribeReorg).
+func (bc *Blockchain) AddBlock(b *Block) error {
+	bc.mu.Lock()
+	defer bc.unlock()
+	if _, err := bc.store.GetHeader(b.Hash()); err == nil {
+		return ErrKnownBlock
+	}
+	if err, ok := bc.invalid[string(b.Header.PreviousHash)]; ok {
+		bc.invalid[string(b.Hash())] = err
+		return fmt.Errorf("%w: %v", ErrInvalidParent, err)
+	}
+	if !bytes.Equal(b.Header.PreviousHash, bc.lastBlock().Hash()) {
+		return bc.addSideBlock(b)
+	}
+
+	if err := bc.validateBlock(b, bc.lastBlock()); err != nil {
+		return err
+	}
+	state := bc.state.Copy()
+	receipts, err := executeChecked(b, state)
+	if err != nil {
+		return err
+	}
+	if err := bc.store.PutBlock(b); err != nil {
+		return err
+	}
+	if err := bc.store.PutReceipts(b.Hash(), receipts); err != nil {
+		return err
+	}
+	if err := bc.store.SetHead(b.Hash()); err != nil {
+		return err
+	}
+	bc.appendCanonical(b, bc.state.undoTo(state))
+	bc.state = state
+	bc.removeIncluded(b)
+	return nil
+}
+
+// CreateBlock seals pooled transactions, up to MaxBlockSize of them, into a
+// new block on top of the chain. Expired transactions are pruned from the pool
+// first. Transactions are executed again while the block is assembled: one
+// that is valid but cannot be carried out is included with a failed receipt,
+// which uses up its nonce, and one that would overspend or no longer applies
+// at all, such as a vote that has become pointless, is dropped from the pool
+// instead of being included.
+func (bc *Blockchain) CreateBlock(previousHash []byte) (*Block, error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.Pool.Prune(time.Now())
+
+	b := NewBlock(previousHash, nil)
+	b.Header.Height = uint64(len(bc.Chain))
+	var snap, votes *Snapshot
+	if bc.Consensus != nil && b.Header.Height > 0 {
+		if bc.Sealer == nil {
+			return nil, ErrNoSealer
+		}
+		var err error
+		if snap, err = bc.snapshot(bc.lastBlock().Hash()); err != nil {
+			return nil, err
+		}
+		votes = snap.copy()
+	}
+
+	state := bc.state.Copy()
+	var receipts []*Receipt
+	var rejected []string
+	for _, p := range bc.Pool.Select(MaxBlockSize, 0) {
+		tx := p.(*poolTx).tx
+		nextVotes := votes
+		if tx.Kind == TxAuthorityVote {
+			if votes == nil {
+				rejected = append(rejected, p.ID())
+				continue
+			}
+			nextVotes = votes.copy()
+			if err := nextVotes.castTx(tx); err != nil {
+				rejected = append(rejected, p.ID())
+				continue
+			}
+		}
+		r, err := state.ExecuteTransaction(tx, &b.Header)
+		if err != nil {
+			rejected = append(rejected, p.ID())
+			continue
+		}
+		votes = nextVotes
+		b.Transactions = append(b.Transactions, *tx)
+		receipts = append(receipts, r)
+	}
+
+	b.Header.MerkleRoot = b.MerkleTree().CalculateMerkleRoot()
+	b.Header.StateRoot = state.Root()
+	b.Header.ReceiptsRoot = ReceiptsRoot(receipts)
+	if snap != nil {
+		parent := &bc.lastBlock().Header
+		b.Header.Proposer = bc.Sealer.Address
+		if err := bc.Consensus.VerifySchedule(&b.Header, parent, snap); err != nil {
+			return nil, err
+		}
+		if err := bc.Consensus.SignBlock(bc.Sealer, b, snap); err != nil {
+			return nil, err
+		}
+	}
+	if err := bc.store.PutBlock(b); err != nil {
+		return nil, err
+	}
+	if err := bc.store.PutReceipts(b.Hash(), receipts); err != nil {
+		return nil, err
+	}
+	if err := bc.store.SetHead(b.Hash()); err != nil {
+		return nil, err
+	}
+	bc.appendCanonical(b, bc.state.undoTo(state))
+	bc.state = state
+	bc.Pool.Remove(rejected...)
+	bc.removeIncluded(b)
+	return b, nil
+}
+
+// Snapshot returns the PoA governance snapshot after the block with the
+// given hash. It is rebuilt from the blocks of the chain, starting from the
+// nearest block whose snapshot is already known.
+func (bc *Blockchain) Snapshot(hash []byte) (*Snapshot, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.snapshot(hash)
+}
+
+func (bc *Blockchain) snapshot(hash []byte) (*Snapshot, error) {
+	if bc.Consensus == nil {
+		return nil, errors.New("chain has no consensus engine")
+	}
+
+	var blocks []*Block
+	var snap *Snapshot
+	for snap == nil {
+		if cached, ok := bc.cachedSnapshot(hash); ok {
+			snap = cached
+			break
+		}
+		b, err := bc.store.GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		if b.Header.Height == 0 {
+			snap = bc.Consensus.Genesis(&b.Header)
+			bc.cacheSnapshot(hash, snap)
+			break
+		}
+		blocks = append(blocks, b)
+		hash = b.Header.PreviousHash
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		next, err := snap.ApplyBlock(blocks[i])
+		if err != nil {
+			return nil, err
+		}
+		bc.cacheSnapshot(next.Hash, next)
+		snap = next
+	}
+	return snap, nil
+}
+
+func (bc *Blockchain) cachedSnapshot(hash []byte) (*Snapshot, bool) {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	snap, ok := bc.snapshots[string(hash)]
+	return snap, ok
+}
+
+func (bc *Blockchain) cacheSnapshot(hash []byte, snap *Snapshot) {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	bc.snapshots[string(hash)] = snap
+}
+
+// AuthoritiesAt returns the authority set in force after the canonical block
+// at height.
+func (bc *Blockchain) AuthoritiesAt(height uint64) ([]Authority, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height >= uint64(len(bc.Chain)) {
+		return nil, ErrBlockNotFound
+	}
+	snap, err := bc.snapshot(bc.Chain[height].Hash())
+	if err != nil {
+		return nil, err
+	}
+	return snap.Authorities, nil
+}
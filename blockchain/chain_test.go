@@ -0,0 +1,71 @@
+package blockchain
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestConcurrentUse reads the chain from several goroutines while blocks
+// are added to it. Run it with -race.
+func TestConcurrentUse(t *testing.T) {
+	bc := newFundedChain(t)
+
+	const blocks = 20
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				head := bc.LastBlock()
+				if _, err := bc.BlockByHeight(head.Header.Height); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := bc.Weight(head.Hash()); err != nil {
+					t.Error(err)
+					return
+				}
+				bc.BalanceOf(bob)
+				bc.ProveAccount(alice)
+				bc.FinalizedHeight()
+				bc.PendingTransactions()
+				for _, loc := range bc.AddressTransactions(alice) {
+					b, err := bc.BlockByHash(loc.BlockHash)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if _, _, ok := bc.Transaction(b.Transactions[loc.Index].ID()); !ok {
+						t.Error("indexed transaction not found")
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for i := uint64(0); i < blocks; i++ {
+		if err := bc.AddTransaction(signedTransfer(t, aliceWallet, i, bob, 10)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bc.CreateBlock(bc.LastBlock().Hash()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if got := bc.BalanceOf(bob); got != blocks*10 {
+		t.Fatalf("bob has %s, want %s", got, Amount(blocks*10))
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
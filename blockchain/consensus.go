@@ -1,67 +1,204 @@
 package blockchain
 
 import (
-	"crypto/sha256"
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
 	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// Default schedule parameters of a PoA engine.
+const (
+	DefaultBlockPeriod    = 5 * time.Second
+	DefaultOutOfTurnDelay = 2 * time.Second
+)
+
+var (
+	ErrUnauthorizedSigner    = errors.New("signer is not an authority")
+	ErrInvalidBlockSignature = errors.New("invalid block signature")
+	ErrTooEarly              = errors.New("block sealed before its slot")
+	ErrRecentlySigned        = errors.New("authority sealed a block too recently")
 )
 
+// Authority is a party allowed to seal blocks, identified by the public key
+// of its wallet. Address is the wallet address derived from that key.
 type Authority struct {
-	Address string
-	IsValid bool
+	Address   string
+	PublicKey *ecdsa.PublicKey
 }
 
+// PoA is a proof-of-authority engine. Authorities take turns sealing blocks
+// in a fixed rotation ordered by address: at height h the authority at
+// position h mod n is in turn. An in-turn block may be sealed Period after
+// its parent. Any other authority may step in if the in-turn one is offline,
+// but has to wait an extra OutOfTurnDelay for every position it is away from
+// the in-turn authority, so the next authority in line gets the first chance.
+// To stop a single authority from sealing a run of blocks, an authority may
+// not seal a block if it sealed any of the previous n/2 blocks.
+//
+// Authorities holds the set the chain starts with. Later changes are voted
+// on in block headers and tracked in Snapshots, see Propose.
 type PoA struct {
-	Authorities []Authority
+	Authorities    []Authority
+	Period         time.Duration
+	OutOfTurnDelay time.Duration
+
+	// proposals are the votes this node puts into the blocks it seals,
+	// keyed by candidate address.
+	proposals map[string]Vote
 }
 
-func NewPoA(addresses []string) *PoA {
-	authorities := make([]Authority, len(addresses))
-	for i, addr := range addresses {
-		authorities[i] = Authority{Address: addr, IsValid: true}
+func NewPoA(keys []*ecdsa.PublicKey) *PoA {
+	poa := &PoA{
+		Period:         DefaultBlockPeriod,
+		OutOfTurnDelay: DefaultOutOfTurnDelay,
+		proposals:      make(map[string]Vote),
 	}
-	return &PoA{Authorities: authorities}
+	for _, key := range keys {
+		poa.Authorities = append(poa.Authorities, Authority{
+			Address:   wallet.GenerateAddress(key),
+			PublicKey: key,
+		})
+	}
+	return poa
 }
 
-func (poa *PoA) IsAuthorized(address string) bool {
-	for _, authority := range poa.Authorities {
-		if authority.Address == address && authority.IsValid {
-			return true
+// Genesis returns the snapshot at the genesis block.
+func (poa *PoA) Genesis(genesis *BlockHeader) *Snapshot {
+	return newSnapshot(genesis.Height, genesis.Hash(), poa.Authorities)
+}
+
+// Propose makes this node vote to add (authorize) or revoke the authority
+// with the given key in every block it seals, until the vote passes or the
+// proposal is discarded.
+func (poa *PoA) Propose(key *ecdsa.PublicKey, authorize bool) {
+	address := wallet.GenerateAddress(key)
+	poa.proposals[address] = Vote{Candidate: address, Key: key, Authorize: authorize}
+}
+
+// Discard drops the proposal for address.
+func (poa *PoA) Discard(address string) {
+	delete(poa.proposals, address)
+}
+
+// nextVote picks the proposal to put into the next block sealed on top of
+// snap. Proposals that have already passed are dropped.
+func (poa *PoA) nextVote(snap *Snapshot) (Vote, bool) {
+	var candidates []string
+	for address, vote := range poa.proposals {
+		if snap.validVote(address, vote.Authorize) {
+			candidates = append(candidates, address)
+		} else {
+			delete(poa.proposals, address)
 		}
 	}
-	return false
+	if len(candidates) == 0 {
+		return Vote{}, false
+	}
+	sort.Strings(candidates)
+	return poa.proposals[candidates[0]], true
 }
 
-func (poa *PoA) AddAuthority(address string) {
-	poa.Authorities = append(poa.Authorities, Authority{Address: address, IsValid: true})
+// NextSlot returns the earliest time address may seal the block that follows
+// parent, given the snapshot at parent.
+func (poa *PoA) NextSlot(snap *Snapshot, parent *BlockHeader, address string) (time.Time, error) {
+	position := -1
+	for i, authority := range snap.Authorities {
+		if authority.Address == address {
+			position = i
+		}
+	}
+	if position < 0 {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrUnauthorizedSigner, address)
+	}
+
+	n := len(snap.Authorities)
+	inTurn := int((parent.Height + 1) % uint64(n))
+	distance := (position - inTurn + n) % n
+	delay := poa.Period + time.Duration(distance)*poa.OutOfTurnDelay
+	return time.Unix(0, int64(parent.Timestamp)).Add(delay), nil
 }
 
-func (poa *PoA) RevokeAuthority(address string) {
-	for i, authority := range poa.Authorities {
-		if authority.Address == address {
-			poa.Authorities[i].IsValid = false
-			break
+// InTurn reports whether header was sealed by the authority whose turn it
+// was. snap is the snapshot at the header's parent.
+func (poa *PoA) InTurn(header *BlockHeader, snap *Snapshot) bool {
+	n := uint64(len(snap.Authorities))
+	return n > 0 && snap.Authorities[header.Height%n].Address == header.Proposer
+}
+
+// VerifySchedule checks that header was sealed in its proposer's slot and
+// that the proposer has not sealed any of the previous SignerLimit blocks.
+// snap is the snapshot at parent.
+func (poa *PoA) VerifySchedule(header *BlockHeader, parent *BlockHeader, snap *Snapshot) error {
+	slot, err := poa.NextSlot(snap, parent, header.Proposer)
+	if err != nil {
+		return err
+	}
+	if header.Timestamp < uint64(slot.UnixNano()) {
+		return fmt.Errorf("%w: %s is %s early", ErrTooEarly, header.Proposer, time.Duration(uint64(slot.UnixNano())-header.Timestamp))
+	}
+	limit := uint64(snap.SignerLimit())
+	for height, address := range snap.Recents {
+		if address == header.Proposer && height+limit > parent.Height {
+			return fmt.Errorf("%w: %s sealed block %d", ErrRecentlySigned, header.Proposer, height)
 		}
 	}
+	return nil
 }
 
-func (poa *PoA) SignBlock(authorityAddress string, block *Block) {
-	if !poa.IsAuthorized(authorityAddress) {
-		panic("Unauthorized authority attempted to sign block")
+// SignBlock seals block with the authority wallet w. snap is the snapshot at
+// the block's parent. If this node has an open proposal it is put into the
+// header as a vote. The Merkle root is recomputed first so the signature
+// always covers the block's transactions.
+func (poa *PoA) SignBlock(w *wallet.Wallet, block *Block, snap *Snapshot) error {
+	if !snap.IsAuthorized(w.Address) {
+		return fmt.Errorf("%w: %s", ErrUnauthorizedSigner, w.Address)
+	}
+	block.Header.MerkleRoot = block.MerkleTree().CalculateMerkleRoot()
+	block.Header.Proposer = w.Address
+	block.Header.VoteCandidate = nil
+	block.Header.VoteAuthorize = false
+	if vote, ok := poa.nextVote(snap); ok {
+		block.Header.VoteCandidate = wallet.PublicKeyToFixedBytes(vote.Key)
+		block.Header.VoteAuthorize = vote.Authorize
+	}
+	signature, err := wallet.Sign(w.PrivateKey, block.Header.SealHash())
+	if err != nil {
+		return fmt.Errorf("failed to sign block: %w", err)
 	}
-	block.Signature = poa.GenerateSignature(authorityAddress, block)
+	block.Header.Signature = signature.Bytes()
+	return nil
 }
 
-func (poa *PoA) GenerateSignature(authorityAddress string, block *Block) string {
-	data := fmt.Sprintf("%x|%s|%d", block.PreviousHash, authorityAddress, block.Timestamp)
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+// VerifyBlock checks that block was sealed by an authority and that its
+// transactions are the ones the signed header commits to.
+func (poa *PoA) VerifyBlock(block *Block, snap *Snapshot) error {
+	if !bytes.Equal(block.Header.MerkleRoot, block.MerkleTree().CalculateMerkleRoot()) {
+		return ErrBadMerkleRoot
+	}
+	return poa.VerifyHeader(&block.Header, snap)
 }
 
-func (poa *PoA) VerifyBlock(block *Block, authorityAddress string) bool {
-	if !poa.IsAuthorized(authorityAddress) {
-		return false
+// VerifyHeader checks the signature of a header on its own, without the
+// block body, against the key of the authority named as its proposer. snap
+// is the snapshot at the header's parent.
+func (poa *PoA) VerifyHeader(header *BlockHeader, snap *Snapshot) error {
+	authority, ok := snap.authority(header.Proposer)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnauthorizedSigner, header.Proposer)
+	}
+	signature, err := wallet.ParseSignature(header.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBlockSignature, err)
+	}
+	if !signature.Verify(authority.PublicKey, header.SealHash()) {
+		return ErrInvalidBlockSignature
 	}
-	generatedSignature := poa.GenerateSignature(authorityAddress, block)
-	return block.Signature == generatedSignature
+	return nil
 }
 
 // Extending the Block struct
@@ -0,0 +1,152 @@
+package blockchain
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// rotation returns n authorities in the order they take turns.
+func rotation(t *testing.T, n int) []*wallet.Wallet {
+	var ws []*wallet.Wallet
+	for i := 0; i < n; i++ {
+		ws = append(ws, newAuthority(t))
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i].Address < ws[j].Address })
+	return ws
+}
+
+func TestProposerRotation(t *testing.T) {
+	ws := rotation(t, 3)
+	snap := NewPoA(keys(ws[2], ws[0], ws[1])).Genesis(&BlockHeader{})
+	for height := uint64(0); height < 6; height++ {
+		want := ws[height%3].Address
+		if got := snap.Proposer(height); got != want {
+			t.Errorf("Proposer(%d) = %s, want %s", height, got, want)
+		}
+	}
+	if got := snap.SignerLimit(); got != 1 {
+		t.Errorf("SignerLimit = %d, want 1", got)
+	}
+}
+
+func TestVerifySchedule(t *testing.T) {
+	ws := rotation(t, 3)
+	poa := NewPoA(keys(ws...))
+	start := time.Unix(1700000000, 0)
+	parent := &BlockHeader{Height: 3, Timestamp: uint64(start.UnixNano())}
+	// Block 4 is ws[1]'s turn, ws[2] is one position and ws[0] two
+	// positions away.
+	tests := []struct {
+		name     string
+		proposer *wallet.Wallet
+		after    time.Duration
+		recents  map[uint64]string
+		want     error
+	}{
+		{"in turn", ws[1], DefaultBlockPeriod, nil, nil},
+		{"in turn too early", ws[1], DefaultBlockPeriod - 1, nil, ErrTooEarly},
+		{"next in line", ws[2], DefaultBlockPeriod + DefaultOutOfTurnDelay, nil, nil},
+		{"next in line too early", ws[2], DefaultBlockPeriod + DefaultOutOfTurnDelay - 1, nil, ErrTooEarly},
+		{"last in line", ws[0], DefaultBlockPeriod + 2*DefaultOutOfTurnDelay, nil, nil},
+		{"last in line too early", ws[0], DefaultBlockPeriod + DefaultOutOfTurnDelay, nil, ErrTooEarly},
+		{"sealed the parent", ws[1], DefaultBlockPeriod, map[uint64]string{3: ws[1].Address}, ErrRecentlySigned},
+		{"sealed before the limit", ws[1], DefaultBlockPeriod, map[uint64]string{2: ws[1].Address}, nil},
+		{"stranger", newAuthority(t), time.Hour, nil, ErrUnauthorizedSigner},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap := poa.Genesis(&BlockHeader{})
+			for height, address := range tt.recents {
+				snap.Recents[height] = address
+			}
+			h := &BlockHeader{
+				Height:    4,
+				Timestamp: uint64(start.Add(tt.after).UnixNano()),
+				Proposer:  tt.proposer.Address,
+			}
+			if err := poa.VerifySchedule(h, parent, snap); !errors.Is(err, tt.want) {
+				t.Fatalf("VerifySchedule: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddBlockChecksSchedule(t *testing.T) {
+	ws := rotation(t, 3)
+	bc := newTestChain(t)
+	bc.Consensus = NewPoA(keys(ws...))
+
+	// Block 1 is ws[1]'s turn; ws[0] is two positions away.
+	b := childBlock(bc)
+	b.Header.Timestamp = bc.LastBlock().Header.Timestamp + uint64(DefaultBlockPeriod)
+	seal(t, bc, ws[0], b)
+	if err := bc.AddBlock(b); !errors.Is(err, ErrBadTimestamp) {
+		t.Fatalf("out of turn block: got %v, want %v", err, ErrBadTimestamp)
+	}
+	seal(t, bc, ws[1], b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("in turn block: %v", err)
+	}
+}
+
+// sealNext seals an empty block on top of bc with w and adds it.
+func sealNext(t *testing.T, bc *Blockchain, w *wallet.Wallet) *Block {
+	t.Helper()
+	b := childBlock(bc)
+	seal(t, bc, w, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("block %d: %v", b.Header.Height, err)
+	}
+	return b
+}
+
+func TestAuthorityVotes(t *testing.T) {
+	ws := rotation(t, 3)
+	candidate := newAuthority(t)
+	bc := newTestChain(t)
+	bc.Consensus = newTestPoA(ws...)
+	authorized := func(height uint64) bool {
+		t.Helper()
+		authorities, err := bc.AuthoritiesAt(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range authorities {
+			if a.Address == candidate.Address {
+				return true
+			}
+		}
+		return false
+	}
+
+	bc.Consensus.Propose(candidate.PublicKey, true)
+	b := sealNext(t, bc, ws[0])
+	if len(b.Header.VoteCandidate) == 0 || !b.Header.VoteAuthorize {
+		t.Fatalf("block 1 carries no vote to add the candidate")
+	}
+	bc.Consensus.Discard(candidate.Address)
+	if b := sealNext(t, bc, ws[1]); len(b.Header.VoteCandidate) != 0 {
+		t.Fatalf("block 2 carries a discarded vote")
+	}
+	// Voting again replaces the earlier vote instead of adding to it.
+	bc.Consensus.Propose(candidate.PublicKey, true)
+	sealNext(t, bc, ws[0])
+	if authorized(3) {
+		t.Fatalf("candidate added with one authority voting twice")
+	}
+	sealNext(t, bc, ws[1])
+	if !authorized(4) {
+		t.Fatalf("candidate not added with two of three authorities voting")
+	}
+	if authorized(3) {
+		t.Fatalf("AuthoritiesAt(3) changed after block 4")
+	}
+	// The settled vote is no longer proposed, and the new authority may seal.
+	if b := sealNext(t, bc, candidate); len(b.Header.VoteCandidate) != 0 {
+		t.Fatalf("block 5 repeats a settled vote")
+	}
+}
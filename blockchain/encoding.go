@@ -0,0 +1,719 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// EncodingVersion is the version of the canonical binary encoding written by
+// EncodeTransaction and EncodeBlock. It is the first byte of every encoding.
+const EncodingVersion byte = 1
+
+// Kinds of objects in the canonical encoding. The kind is the second byte of
+// every encoding, so the bytes hashed for one kind of object can never be
+// mistaken for another.
+const (
+	kindBlock                 byte = 3
+	kindBlockHeader           byte = 4
+	kindBlockSealing          byte = 5
+	kindTransaction           byte = 6
+	kindTransactionSigning    byte = 7
+	kindMerkleProof           byte = 8
+	kindMerkleMultiproof      byte = 9
+	kindAccount               byte = 10
+	kindStateProof            byte = 11
+	kindPrecommit             byte = 12
+	kindPrecommitSigning      byte = 13
+	kindFinalityCertificate   byte = 14
+	kindGenesis               byte = 15
+	kindReceipt               byte = 16
+	kindReceipts              byte = 17
+	kindDonatePayload         byte = 18
+	kindCreateCampaignPayload byte = 19
+	kindReleaseFundsPayload   byte = 20
+	kindRefundPayload         byte = 21
+	kindAuthorityVotePayload  byte = 22
+	kindCampaign              byte = 23
+	kindContribution          byte = 24
+)
+
+// Kinds 1 and 2 were version 1 transactions and signing payloads. They are
+// not reused, so an old encoding is rejected as being of the wrong kind.
+
+var ErrMalformedEncoding = errors.New("malformed encoding")
+
+// The canonical encoding is a plain concatenation of fields in a fixed
+// order. Integers are fixed-width big-endian, byte strings are prefixed with
+// their length as a 32-bit big-endian integer. There is exactly one encoding
+// for every value, so it is safe to hash.
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder(kind byte) *encoder {
+	return &encoder{buf: []byte{EncodingVersion, kind}}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) bytes(v []byte) {
+	e.uint32(uint32(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *encoder) string(v string) {
+	e.bytes([]byte(v))
+}
+
+// decoder reads what encoder writes. The first error sticks and every
+// subsequent read returns a zero value, so callers only check err once.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func newDecoder(data []byte, kind byte) *decoder {
+	d := &decoder{buf: data}
+	if len(data) < 2 {
+		d.fail("missing header")
+	} else if data[0] != EncodingVersion {
+		d.fail(fmt.Sprintf("unsupported version %d", data[0]))
+	} else if data[1] != kind {
+		d.fail(fmt.Sprintf("expected kind %d, got %d", kind, data[1]))
+	} else {
+		d.buf = data[2:]
+	}
+	return d
+}
+
+func (d *decoder) fail(reason string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrMalformedEncoding, reason)
+	}
+	d.buf = nil
+}
+
+func (d *decoder) take(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.buf)) < n {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	v := d.buf[:n]
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) uint32() uint32 {
+	v := d.take(4)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(v)
+}
+
+func (d *decoder) uint64() uint64 {
+	v := d.take(8)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+func (d *decoder) bool() bool {
+	v := d.take(1)
+	if v == nil {
+		return false
+	}
+	if v[0] > 1 {
+		d.fail("invalid boolean")
+	}
+	return v[0] == 1
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	if n == 0 {
+		return nil
+	}
+	return append([]byte(nil), d.take(uint64(n))...)
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+// finish returns the first error, or an error if there is unread data left.
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		d.fail("trailing data")
+	}
+	return d.err
+}
+
+func encodeTransaction(tx *Transactions, kind byte) []byte {
+	e := newEncoder(kind)
+	e.uint32(tx.Version)
+	e.string(tx.ChainID)
+	e.uint64(tx.Nonce)
+	e.bytes(tx.SenderPublicKey)
+	e.bytes(tx.SenderHash)
+	e.bytes(tx.RecipientHash)
+	e.uint64(uint64(tx.Value))
+	e.uint64(tx.Timestamp)
+	e.uint32(uint32(tx.Kind))
+	e.bytes(tx.Payload)
+	if kind == kindTransaction {
+		e.bytes(tx.Signature)
+	}
+	return e.buf
+}
+
+// EncodeTransaction returns the canonical encoding of a transaction,
+// including its signature.
+func EncodeTransaction(tx *Transactions) []byte {
+	return encodeTransaction(tx, kindTransaction)
+}
+
+// DecodeTransaction is the inverse of EncodeTransaction. Transactions of any
+// version but the current one are rejected.
+func DecodeTransaction(data []byte) (*Transactions, error) {
+	d := newDecoder(data, kindTransaction)
+	tx := &Transactions{Version: d.uint32()}
+	if d.err == nil && tx.Version != TransactionVersion {
+		d.fail(fmt.Sprintf("unsupported transaction version %d", tx.Version))
+	}
+	tx.ChainID = d.string()
+	tx.Nonce = d.uint64()
+	tx.SenderPublicKey = d.bytes()
+	tx.SenderHash = d.bytes()
+	tx.RecipientHash = d.bytes()
+	tx.Value = Amount(d.uint64())
+	tx.Timestamp = d.uint64()
+	tx.Kind = TxKind(d.uint32())
+	tx.Payload = d.bytes()
+	tx.Signature = d.bytes()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func encodeBlockHeader(h *BlockHeader, kind byte) []byte {
+	e := newEncoder(kind)
+	e.uint32(h.Version)
+	e.uint64(h.Height)
+	e.bytes(h.PreviousHash)
+	e.bytes(h.MerkleRoot)
+	e.bytes(h.StateRoot)
+	e.uint64(h.Timestamp)
+	e.string(h.Proposer)
+	e.bytes(h.VoteCandidate)
+	e.bool(h.VoteAuthorize)
+	e.bytes(h.ReceiptsRoot)
+	if kind == kindBlockHeader {
+		e.bytes(h.Signature)
+	}
+	return e.buf
+}
+
+// EncodeBlockHeader returns the canonical encoding of a block header.
+func EncodeBlockHeader(h *BlockHeader) []byte {
+	return encodeBlockHeader(h, kindBlockHeader)
+}
+
+// DecodeBlockHeader is the inverse of EncodeBlockHeader.
+func DecodeBlockHeader(data []byte) (*BlockHeader, error) {
+	d := newDecoder(data, kindBlockHeader)
+	h := &BlockHeader{Version: d.uint32()}
+	if d.err == nil && h.Version != BlockVersion {
+		d.fail(fmt.Sprintf("unsupported block version %d", h.Version))
+	}
+	h.Height = d.uint64()
+	h.PreviousHash = d.bytes()
+	h.MerkleRoot = d.bytes()
+	h.StateRoot = d.bytes()
+	h.Timestamp = d.uint64()
+	h.Proposer = d.string()
+	h.VoteCandidate = d.bytes()
+	h.VoteAuthorize = d.bool()
+	h.ReceiptsRoot = d.bytes()
+	h.Signature = d.bytes()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// EncodeBlock returns the canonical encoding of a block: its header followed
+// by all of its transactions.
+func EncodeBlock(b *Block) []byte {
+	e := newEncoder(kindBlock)
+	e.bytes(EncodeBlockHeader(&b.Header))
+	e.uint32(uint32(len(b.Transactions)))
+	for i := range b.Transactions {
+		e.bytes(EncodeTransaction(&b.Transactions[i]))
+	}
+	return e.buf
+}
+
+// DecodeBlock is the inverse of EncodeBlock.
+func DecodeBlock(data []byte) (*Block, error) {
+	d := newDecoder(data, kindBlock)
+	header, err := DecodeBlockHeader(d.bytes())
+	if err != nil {
+		return nil, err
+	}
+	b := &Block{Header: *header}
+
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		tx, err := DecodeTransaction(d.bytes())
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %w", i, err)
+		}
+		b.Transactions = append(b.Transactions, *tx)
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// DecodeBlockHeaderFromBlock decodes only the header of an encoded block,
+// without touching its transactions.
+func DecodeBlockHeaderFromBlock(data []byte) (*BlockHeader, error) {
+	d := newDecoder(data, kindBlock)
+	raw := d.bytes()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return DecodeBlockHeader(raw)
+}
+
+// EncodeMerkleProof returns the canonical encoding of a Merkle proof. The
+// proof must have as many sides as siblings.
+func EncodeMerkleProof(p *MerkleProof) []byte {
+	e := newEncoder(kindMerkleProof)
+	e.buf = append(e.buf, byte(p.Scheme))
+	e.uint64(p.LeafIndex)
+	e.uint64(p.LeafCount)
+	e.uint32(uint32(len(p.Siblings)))
+	for i, sibling := range p.Siblings {
+		e.bool(p.Sides[i] == SideRight)
+		e.bytes(sibling)
+	}
+	return e.buf
+}
+
+// DecodeMerkleProof is the inverse of EncodeMerkleProof.
+func DecodeMerkleProof(data []byte) (*MerkleProof, error) {
+	d := newDecoder(data, kindMerkleProof)
+	p := &MerkleProof{}
+	if scheme := d.take(1); scheme != nil {
+		p.Scheme = MerkleScheme(scheme[0])
+		if !p.Scheme.valid() {
+			d.fail(fmt.Sprintf("unknown merkle scheme %d", scheme[0]))
+		}
+	}
+	p.LeafIndex = d.uint64()
+	p.LeafCount = d.uint64()
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		side := SideLeft
+		if d.bool() {
+			side = SideRight
+		}
+		p.Sides = append(p.Sides, side)
+		p.Siblings = append(p.Siblings, d.bytes())
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// EncodeMerkleMultiproof returns the canonical encoding of a Merkle
+// multiproof.
+func EncodeMerkleMultiproof(p *MerkleMultiproof) []byte {
+	e := newEncoder(kindMerkleMultiproof)
+	e.buf = append(e.buf, byte(p.Scheme))
+	e.uint64(p.LeafCount)
+	e.uint32(uint32(len(p.Indices)))
+	for _, index := range p.Indices {
+		e.uint64(index)
+	}
+	e.uint32(uint32(len(p.Hashes)))
+	for _, hash := range p.Hashes {
+		e.bytes(hash)
+	}
+	return e.buf
+}
+
+// DecodeMerkleMultiproof is the inverse of EncodeMerkleMultiproof.
+func DecodeMerkleMultiproof(data []byte) (*MerkleMultiproof, error) {
+	d := newDecoder(data, kindMerkleMultiproof)
+	p := &MerkleMultiproof{}
+	if scheme := d.take(1); scheme != nil {
+		p.Scheme = MerkleScheme(scheme[0])
+		if !p.Scheme.valid() {
+			d.fail(fmt.Sprintf("unknown merkle scheme %d", scheme[0]))
+		}
+	}
+	p.LeafCount = d.uint64()
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		p.Indices = append(p.Indices, d.uint64())
+	}
+	count = d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		p.Hashes = append(p.Hashes, d.bytes())
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// EncodeAccount returns the canonical encoding of an account, the value
+// stored in the state tree.
+func EncodeAccount(a *Account) []byte {
+	e := newEncoder(kindAccount)
+	e.uint64(uint64(a.Balance))
+	e.uint64(a.Nonce)
+	return e.buf
+}
+
+// DecodeAccount is the inverse of EncodeAccount.
+func DecodeAccount(data []byte) (*Account, error) {
+	d := newDecoder(data, kindAccount)
+	a := &Account{Balance: Amount(d.uint64()), Nonce: d.uint64()}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// EncodeStateProof returns the canonical encoding of a state proof.
+func EncodeStateProof(p *StateProof) []byte {
+	e := newEncoder(kindStateProof)
+	e.uint32(uint32(len(p.Siblings)))
+	for _, sibling := range p.Siblings {
+		e.bytes(sibling)
+	}
+	e.bool(p.Leaf != nil)
+	if p.Leaf != nil {
+		e.bytes(p.Leaf.Path)
+		e.bytes(p.Leaf.ValueHash)
+	}
+	return e.buf
+}
+
+// DecodeStateProof is the inverse of EncodeStateProof.
+func DecodeStateProof(data []byte) (*StateProof, error) {
+	d := newDecoder(data, kindStateProof)
+	p := &StateProof{}
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		p.Siblings = append(p.Siblings, d.bytes())
+	}
+	if d.bool() {
+		p.Leaf = &StateProofLeaf{Path: d.bytes(), ValueHash: d.bytes()}
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func encodePrecommit(p *Precommit, kind byte) []byte {
+	e := newEncoder(kind)
+	e.uint64(p.Height)
+	e.bytes(p.BlockHash)
+	e.string(p.Authority)
+	if kind == kindPrecommit {
+		e.bytes(p.Signature)
+	}
+	return e.buf
+}
+
+// EncodePrecommit returns the canonical encoding of a precommit, signature
+// included.
+func EncodePrecommit(p *Precommit) []byte {
+	return encodePrecommit(p, kindPrecommit)
+}
+
+// DecodePrecommit is the inverse of EncodePrecommit.
+func DecodePrecommit(data []byte) (*Precommit, error) {
+	d := newDecoder(data, kindPrecommit)
+	p := &Precommit{Height: d.uint64(), BlockHash: d.bytes(), Authority: d.string(), Signature: d.bytes()}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// EncodeFinalityCertificate returns the canonical encoding of a finality
+// certificate.
+func EncodeFinalityCertificate(c *FinalityCertificate) []byte {
+	e := newEncoder(kindFinalityCertificate)
+	e.uint64(c.Height)
+	e.bytes(c.BlockHash)
+	e.uint32(uint32(len(c.Precommits)))
+	for _, p := range c.Precommits {
+		e.bytes(EncodePrecommit(p))
+	}
+	return e.buf
+}
+
+// DecodeFinalityCertificate is the inverse of EncodeFinalityCertificate.
+func DecodeFinalityCertificate(data []byte) (*FinalityCertificate, error) {
+	d := newDecoder(data, kindFinalityCertificate)
+	c := &FinalityCertificate{Height: d.uint64(), BlockHash: d.bytes()}
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		p, err := DecodePrecommit(d.bytes())
+		if err != nil {
+			return nil, fmt.Errorf("precommit %d: %w", i, err)
+		}
+		c.Precommits = append(c.Precommits, p)
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// EncodeGenesis returns the canonical encoding of a genesis spec. Defaults
+// are written out and authorities and allocations are sorted, so specs that
+// mean the same encode the same.
+func EncodeGenesis(g *Genesis) []byte {
+	e := newEncoder(kindGenesis)
+	e.string(g.ChainID)
+	e.uint64(g.timestamp())
+	e.uint64(uint64(g.period()))
+	e.uint64(uint64(g.outOfTurnDelay()))
+
+	keys := make([][]byte, len(g.Authorities))
+	for i, key := range g.Authorities {
+		keys[i] = wallet.PublicKeyToFixedBytes(key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	e.uint32(uint32(len(keys)))
+	for _, key := range keys {
+		e.bytes(key)
+	}
+
+	alloc := g.sortedAlloc()
+	e.uint32(uint32(len(alloc)))
+	for _, a := range alloc {
+		e.bytes(a.Address)
+		e.uint64(uint64(a.Balance))
+	}
+	return e.buf
+}
+
+// EncodeReceipt returns the canonical encoding of a receipt. The block hash,
+// height and index are left out: they follow from where the receipt is.
+func EncodeReceipt(r *Receipt) []byte {
+	e := newEncoder(kindReceipt)
+	e.bytes(r.TxID)
+	e.bool(r.Status == ReceiptSuccess)
+	e.uint64(uint64(r.Fee))
+	e.string(r.Error)
+	e.uint32(uint32(len(r.Events)))
+	for _, event := range r.Events {
+		e.string(event.Type)
+		e.uint32(uint32(len(event.Attributes)))
+		for _, attr := range event.Attributes {
+			e.string(attr.Key)
+			e.string(attr.Value)
+		}
+	}
+	return e.buf
+}
+
+// DecodeReceipt is the inverse of EncodeReceipt.
+func DecodeReceipt(data []byte) (*Receipt, error) {
+	d := newDecoder(data, kindReceipt)
+	r := &Receipt{TxID: d.bytes(), Status: ReceiptFailed}
+	if d.bool() {
+		r.Status = ReceiptSuccess
+	}
+	r.Fee = Amount(d.uint64())
+	r.Error = d.string()
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		event := Event{Type: d.string()}
+		attrs := d.uint32()
+		for j := uint32(0); j < attrs && d.err == nil; j++ {
+			event.Attributes = append(event.Attributes, EventAttribute{Key: d.string(), Value: d.string()})
+		}
+		r.Events = append(r.Events, event)
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// EncodeReceipts returns the canonical encoding of the receipts of a block,
+// in transaction order.
+func EncodeReceipts(receipts []*Receipt) []byte {
+	e := newEncoder(kindReceipts)
+	e.uint32(uint32(len(receipts)))
+	for _, r := range receipts {
+		e.bytes(EncodeReceipt(r))
+	}
+	return e.buf
+}
+
+// DecodeReceipts is the inverse of EncodeReceipts. Height and Index are not
+// encoded; the caller fills them in from the block.
+func DecodeReceipts(data []byte) ([]*Receipt, error) {
+	d := newDecoder(data, kindReceipts)
+	var receipts []*Receipt
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		r, err := DecodeReceipt(d.bytes())
+		if err != nil {
+			return nil, fmt.Errorf("receipt %d: %w", i, err)
+		}
+		receipts = append(receipts, r)
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+func encodeCampaignID(kind byte, id []byte) []byte {
+	e := newEncoder(kind)
+	e.bytes(id)
+	return e.buf
+}
+
+func decodeCampaignID(data []byte, kind byte) ([]byte, error) {
+	d := newDecoder(data, kind)
+	id := d.bytes()
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func encodeCreateCampaign(p *CreateCampaignPayload) []byte {
+	e := newEncoder(kindCreateCampaignPayload)
+	e.bytes(p.Beneficiary)
+	e.uint64(uint64(p.Goal))
+	e.uint64(p.Deadline)
+	e.bytes(p.DescriptionHash)
+	e.uint32(uint32(len(p.Milestones)))
+	for _, milestone := range p.Milestones {
+		e.uint64(uint64(milestone))
+	}
+	return e.buf
+}
+
+func decodeCreateCampaign(data []byte) (*CreateCampaignPayload, error) {
+	d := newDecoder(data, kindCreateCampaignPayload)
+	p := &CreateCampaignPayload{
+		Beneficiary:     d.bytes(),
+		Goal:            Amount(d.uint64()),
+		Deadline:        d.uint64(),
+		DescriptionHash: d.bytes(),
+	}
+	count := d.uint32()
+	if d.err == nil && count > MaxMilestones {
+		d.fail(fmt.Sprintf("%d milestones", count))
+	}
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		p.Milestones = append(p.Milestones, Amount(d.uint64()))
+	}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func encodeReleaseFunds(p *ReleaseFundsPayload) []byte {
+	e := newEncoder(kindReleaseFundsPayload)
+	e.bytes(p.CampaignID)
+	e.uint32(p.Milestone)
+	return e.buf
+}
+
+func decodeReleaseFunds(data []byte) (*ReleaseFundsPayload, error) {
+	d := newDecoder(data, kindReleaseFundsPayload)
+	p := &ReleaseFundsPayload{CampaignID: d.bytes(), Milestone: d.uint32()}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func encodeAuthorityVote(p *AuthorityVotePayload) []byte {
+	e := newEncoder(kindAuthorityVotePayload)
+	e.bytes(p.Candidate)
+	e.bool(p.Authorize)
+	return e.buf
+}
+
+func decodeAuthorityVote(data []byte) (*AuthorityVotePayload, error) {
+	d := newDecoder(data, kindAuthorityVotePayload)
+	p := &AuthorityVotePayload{Candidate: d.bytes(), Authorize: d.bool()}
+	if err := d.finish(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// EncodeCampaign returns the canonical encoding of a campaign, the value
+// stored under CampaignKey in the state tree. Contributions are stored under
+// keys of their own.
+func EncodeCampaign(c *Campaign) []byte {
+	e := newEncoder(kindCampaign)
+	e.bytes(c.ID)
+	e.bytes(c.Owner)
+	e.bytes(c.Beneficiary)
+	e.uint64(uint64(c.Goal))
+	e.uint64(c.Deadline)
+	e.bytes(c.DescriptionHash)
+	e.uint32(uint32(len(c.Milestones)))
+	for _, milestone := range c.Milestones {
+		e.uint64(uint64(milestone))
+	}
+	e.uint64(uint64(c.Raised))
+	e.uint64(uint64(c.Withdrawn))
+	e.uint32(c.Released)
+	return e.buf
+}
+
+// EncodeContribution returns the canonical encoding of what a donor has
+// given a campaign, the value stored under ContributionKey.
+func EncodeContribution(amount Amount) []byte {
+	e := newEncoder(kindContribution)
+	e.uint64(uint64(amount))
+	return e.buf
+}
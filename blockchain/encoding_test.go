@@ -0,0 +1,217 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// goldenTransaction is the transaction of the golden vectors in
+// docs/encoding.md.
+func goldenTransaction() *Transactions {
+	return &Transactions{
+		Version:         5,
+		ChainID:         "daanveer-test",
+		Nonce:           7,
+		SenderPublicKey: []byte{0xaa, 0xbb},
+		SenderHash:      []byte("alice"),
+		RecipientHash:   []byte("bob"),
+		Value:           1250,
+		Timestamp:       1700000000000000000,
+		Signature:       []byte{1, 2, 3},
+	}
+}
+
+// goldenBlock is the block of the golden vectors in docs/encoding.md.
+func goldenBlock() *Block {
+	b := &Block{
+		Header: BlockHeader{
+			Version:       6,
+			Height:        1,
+			PreviousHash:  []byte{0xaa, 0xbb},
+			Timestamp:     1700000000000000001,
+			Proposer:      "authority1",
+			VoteCandidate: []byte{0x33},
+			VoteAuthorize: true,
+			StateRoot:     []byte{0xcc},
+			ReceiptsRoot:  []byte{0xdd},
+			Signature:     []byte("sig"),
+		},
+		Transactions: []Transactions{*goldenTransaction()},
+	}
+	b.Header.MerkleRoot = b.MerkleTree().CalculateMerkleRoot()
+	return b
+}
+
+const (
+	goldenTransactionEncoding    = "0106000000050000000d6461616e766565722d74657374000000000000000700000002aabb00000005616c69636500000003626f6200000000000004e217979cfe362a0000000000000000000000000003010203"
+	goldenTransactionHash        = "60c15d8e4f0a017dbde268c8aa5e6a2687f46a9c32cb659d4b1506b6410841d0"
+	goldenTransactionSigningHash = "efd67bdb46e58b49d60159295ca3a768bde1e5649085a084e61433070716f7b2"
+	goldenHeaderEncoding         = "010400000006000000000000000100000002aabb0000002092709c92ba242afbb22b5a71d8b53be665aa263272e910b73fd6e940e97a887f00000001cc17979cfe362a00010000000a617574686f726974793100000001330100000001dd00000003736967"
+	goldenBlockEncoding          = "010300000065010400000006000000000000000100000002aabb0000002092709c92ba242afbb22b5a71d8b53be665aa263272e910b73fd6e940e97a887f00000001cc17979cfe362a00010000000a617574686f726974793100000001330100000001dd0000000373696700000001000000540106000000050000000d6461616e766565722d74657374000000000000000700000002aabb00000005616c69636500000003626f6200000000000004e217979cfe362a0000000000000000000000000003010203"
+	goldenBlockHash              = "2c16545f30367bfa0371d5963df9d384a51828f34042da377e0136fabf408526"
+)
+
+func TestTransactionGoldenVector(t *testing.T) {
+	tx := goldenTransaction()
+	if got := hex.EncodeToString(EncodeTransaction(tx)); got != goldenTransactionEncoding {
+		t.Errorf("encoding = %s, want %s", got, goldenTransactionEncoding)
+	}
+	if got := hex.EncodeToString(tx.Hash()); got != goldenTransactionHash {
+		t.Errorf("Hash = %s, want %s", got, goldenTransactionHash)
+	}
+	if got := hex.EncodeToString(tx.SigningHash()); got != goldenTransactionSigningHash {
+		t.Errorf("SigningHash = %s, want %s", got, goldenTransactionSigningHash)
+	}
+
+	decoded, err := DecodeTransaction(mustHex(t, goldenTransactionEncoding))
+	if err != nil {
+		t.Fatalf("DecodeTransaction: %v", err)
+	}
+	if !bytes.Equal(decoded.Hash(), tx.Hash()) || decoded.Value != tx.Value || decoded.Timestamp != tx.Timestamp {
+		t.Errorf("decoded %+v, want %+v", decoded, tx)
+	}
+}
+
+func TestBlockGoldenVector(t *testing.T) {
+	b := goldenBlock()
+	if got := hex.EncodeToString(EncodeBlockHeader(&b.Header)); got != goldenHeaderEncoding {
+		t.Errorf("header encoding = %s, want %s", got, goldenHeaderEncoding)
+	}
+	if got := hex.EncodeToString(EncodeBlock(b)); got != goldenBlockEncoding {
+		t.Errorf("encoding = %s, want %s", got, goldenBlockEncoding)
+	}
+	if got := hex.EncodeToString(b.Hash()); got != goldenBlockHash {
+		t.Errorf("Hash = %s, want %s", got, goldenBlockHash)
+	}
+
+	header, err := DecodeBlockHeader(mustHex(t, goldenHeaderEncoding))
+	if err != nil {
+		t.Fatalf("DecodeBlockHeader: %v", err)
+	}
+	if got := hex.EncodeToString(header.Hash()); got != goldenBlockHash {
+		t.Errorf("decoded header hash = %s, want %s", got, goldenBlockHash)
+	}
+	fromBlock, err := DecodeBlockHeaderFromBlock(mustHex(t, goldenBlockEncoding))
+	if err != nil {
+		t.Fatalf("DecodeBlockHeaderFromBlock: %v", err)
+	}
+	if got := hex.EncodeToString(fromBlock.Hash()); got != goldenBlockHash {
+		t.Errorf("DecodeBlockHeaderFromBlock hash = %s, want %s", got, goldenBlockHash)
+	}
+	decoded, err := DecodeBlock(mustHex(t, goldenBlockEncoding))
+	if err != nil {
+		t.Fatalf("DecodeBlock: %v", err)
+	}
+	if got := hex.EncodeToString(decoded.Hash()); got != goldenBlockHash {
+		t.Errorf("decoded block hash = %s, want %s", got, goldenBlockHash)
+	}
+	if got := hex.EncodeToString(EncodeBlock(decoded)); got != goldenBlockEncoding {
+		t.Errorf("decoded block encodes as %s", got)
+	}
+}
+
+func TestBlockRoundTripWithoutTransactions(t *testing.T) {
+	b := goldenBlock()
+	b.Transactions = nil
+	decoded, err := DecodeBlock(EncodeBlock(b))
+	if err != nil {
+		t.Fatalf("DecodeBlock: %v", err)
+	}
+	if !bytes.Equal(EncodeBlock(decoded), EncodeBlock(b)) || len(decoded.Transactions) != 0 {
+		t.Fatalf("round trip changed the block: %+v, want %+v", decoded, b)
+	}
+}
+
+// malformed is a broken encoding: valid is changed by edit, which gets a
+// copy.
+type malformed struct {
+	name string
+	edit func(data []byte) []byte
+}
+
+// setUint32 overwrites the big-endian uint32 at offset.
+func setUint32(offset int, v uint32) func([]byte) []byte {
+	return func(data []byte) []byte {
+		binary.BigEndian.PutUint32(data[offset:], v)
+		return data
+	}
+}
+
+// commonMalformed are the edits that break any encoding.
+var commonMalformed = []malformed{
+	{"empty", func([]byte) []byte { return nil }},
+	{"header only", func(data []byte) []byte { return data[:2] }},
+	{"unknown encoding version", func(data []byte) []byte { data[0] = 2; return data }},
+	{"wrong kind", func(data []byte) []byte { data[1] = kindTransactionSigning; return data }},
+	{"truncated", func(data []byte) []byte { return data[:len(data)-1] }},
+	{"trailing byte", func(data []byte) []byte { return append(data, 0) }},
+}
+
+func checkMalformed(t *testing.T, valid []byte, cases []malformed, decode func([]byte) error) {
+	t.Helper()
+	for _, c := range append(append([]malformed(nil), commonMalformed...), cases...) {
+		t.Run(c.name, func(t *testing.T) {
+			data := c.edit(append([]byte(nil), valid...))
+			if err := decode(data); !errors.Is(err, ErrMalformedEncoding) {
+				t.Fatalf("got %v, want %v", err, ErrMalformedEncoding)
+			}
+		})
+	}
+}
+
+func TestDecodeTransactionRejectsMalformed(t *testing.T) {
+	valid := EncodeTransaction(goldenTransaction())
+	checkMalformed(t, valid, []malformed{
+		{"version 1 kind", func(data []byte) []byte { data[1] = 1; return data }},
+		{"version 1", setUint32(2, 1)},
+		{"future version", setUint32(2, TransactionVersion+1)},
+		{"signature longer than the data", setUint32(len(valid)-7, 0xffffffff)},
+	}, func(data []byte) error {
+		_, err := DecodeTransaction(data)
+		return err
+	})
+}
+
+func TestDecodeBlockHeaderRejectsMalformed(t *testing.T) {
+	valid := EncodeBlockHeader(&goldenBlock().Header)
+	// The vote candidate 33 is followed by the vote_authorize byte.
+	authorize := bytes.Index(valid, []byte{0, 0, 0, 1, 0x33, 1}) + 5
+	checkMalformed(t, valid, []malformed{
+		{"version 1", setUint32(2, 1)},
+		{"future version", setUint32(2, BlockVersion+1)},
+		{"invalid boolean", func(data []byte) []byte { data[authorize] = 2; return data }},
+	}, func(data []byte) error {
+		_, err := DecodeBlockHeader(data)
+		return err
+	})
+}
+
+func TestDecodeBlockRejectsMalformed(t *testing.T) {
+	b := goldenBlock()
+	valid := EncodeBlock(b)
+	// kind header (2) + header length (4) + header, then the transaction
+	// count, the transaction length and the transaction.
+	count := 2 + 4 + len(EncodeBlockHeader(&b.Header))
+	tx := count + 4 + 4
+	checkMalformed(t, valid, []malformed{
+		{"header of another kind", func(data []byte) []byte { data[2+4+1] = kindBlock; return data }},
+		{"header of a future version", setUint32(2+4+2, BlockVersion+1)},
+		{"more transactions than encoded", setUint32(count, 2)},
+		{"transaction of another kind", func(data []byte) []byte { data[tx+1] = kindBlock; return data }},
+	}, func(data []byte) error {
+		_, err := DecodeBlock(data)
+		return err
+	})
+}
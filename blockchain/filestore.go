@@ -0,0 +1,384 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Record kinds written to a FileStore.
+const (
+	recordBlock byte = 1
+	recordHead  byte = 2
+	// recordMeta holds a metadata key and value, see encodeMetaRecord.
+	recordMeta byte = 3
+	// recordReceipts holds a block hash and the block's encoded receipts,
+	// laid out like a metadata record with the hash as the key.
+	recordReceipts byte = 4
+)
+
+// recordVersion is the version of the record payloads written by this code.
+// It is stored with every record so that a change to the serialized form can
+// tell old records from new ones. Version 4 stores blocks with a separate
+// BlockHeader. Only the current version is read: no store was ever deployed
+// with an older one.
+const recordVersion byte = 4
+
+// recordHeaderSize is kind (1) + version (1) + payload length (4).
+const recordHeaderSize = 6
+
+// FileStore is an append-only, file-backed BlockStore.
+//
+// Every block, every head change, the receipts of every executed block and
+// every metadata change is appended to the file as a record of the form
+// kind|version|length|payload|crc32. Nothing is ever rewritten, so a crash can
+// at worst leave a torn record at the end of the file, which is dropped the
+// next time the store is opened. A damaged record with a valid record
+// anywhere after it cannot be a torn write; OpenFileStore fails instead, so
+// the records after it are never lost. The position of every block and of
+// every block's receipts is kept in memory and both are read back from
+// disk on demand.
+type FileStore struct {
+	file     *os.File
+	size     int64
+	offsets  map[string]int64
+	receipts map[string]int64
+	head     []byte
+	index    canonicalIndex
+	meta     map[string][]byte
+}
+
+// OpenFileStore opens the store at path, creating it if it does not exist,
+// and replays it to rebuild the in-memory indexes.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fs := &FileStore{file: file, offsets: make(map[string]int64), receipts: make(map[string]int64), meta: make(map[string][]byte)}
+	if err := fs.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileStore) replay() error {
+	info, err := fs.file.Stat()
+	if err != nil {
+		return err
+	}
+	fs.size = info.Size()
+
+	var offset int64
+	for {
+		kind, version, payload, next, err := fs.readRecord(offset)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF || errors.Is(err, errCorruptRecord) {
+			if fs.validRecordAfter(offset) {
+				return fmt.Errorf("record at offset %d: %w", offset, errCorruptRecord)
+			}
+			// A torn write at the tail, drop it so new records start on a
+			// clean boundary.
+			if err := fs.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+
+		switch kind {
+		case recordBlock:
+			h, err := decodeHeaderPayload(version, payload)
+			if err != nil {
+				return fmt.Errorf("block at offset %d: %w", offset, err)
+			}
+			fs.offsets[hex.EncodeToString(h.Hash())] = offset
+		case recordHead:
+			fs.head = payload
+		case recordMeta:
+			key, value, err := decodeMetaRecord(payload)
+			if err != nil {
+				return fmt.Errorf("metadata at offset %d: %w", offset, err)
+			}
+			fs.meta[key] = value
+		case recordReceipts:
+			hash, _, err := decodeMetaRecord(payload)
+			if err != nil {
+				return fmt.Errorf("receipts at offset %d: %w", offset, err)
+			}
+			fs.receipts[hex.EncodeToString([]byte(hash))] = offset
+		default:
+			return fmt.Errorf("unknown record kind %d at offset %d", kind, offset)
+		}
+		offset = next
+	}
+	fs.size = offset
+
+	if fs.head == nil {
+		return nil
+	}
+	head, err := fs.GetHeader(fs.head)
+	if err != nil {
+		return fmt.Errorf("head block: %w", err)
+	}
+	return fs.index.rebuild(head, fs.GetHeader)
+}
+
+var errCorruptRecord = errors.New("corrupt record")
+
+// readRecord reads the record at offset and returns its kind, version,
+// payload and the offset of the record that follows it. A record that runs
+// past the end of the file is reported as io.ErrUnexpectedEOF before any of
+// its payload is read, and one whose checksum does not match as
+// errCorruptRecord.
+func (fs *FileStore) readRecord(offset int64) (byte, byte, []byte, int64, error) {
+	if offset == fs.size {
+		return 0, 0, nil, 0, io.EOF
+	}
+	if offset+recordHeaderSize > fs.size {
+		return 0, 0, nil, 0, io.ErrUnexpectedEOF
+	}
+	header := make([]byte, recordHeaderSize)
+	if _, err := fs.file.ReadAt(header, offset); err != nil {
+		return 0, 0, nil, 0, err
+	}
+	kind, version := header[0], header[1]
+	length := binary.BigEndian.Uint32(header[2:])
+	next := offset + recordHeaderSize + int64(length) + crc32.Size
+	if next > fs.size {
+		return 0, 0, nil, 0, io.ErrUnexpectedEOF
+	}
+
+	body := make([]byte, int64(length)+crc32.Size)
+	if _, err := fs.file.ReadAt(body, offset+recordHeaderSize); err != nil {
+		return 0, 0, nil, 0, err
+	}
+	payload, sum := body[:length], body[length:]
+	if crc32.ChecksumIEEE(append(header, payload...)) != binary.BigEndian.Uint32(sum) {
+		return 0, 0, nil, 0, errCorruptRecord
+	}
+	return kind, version, payload, next, nil
+}
+
+// validRecordAfter reports whether a complete record with a matching
+// checksum starts anywhere after offset. A torn write is always the last
+// thing in the file, so a damaged record followed by a valid one was damaged
+// some other way, for instance by a flipped bit in its length.
+func (fs *FileStore) validRecordAfter(offset int64) bool {
+	for next := offset + 1; next+recordHeaderSize+crc32.Size <= fs.size; next++ {
+		if _, _, _, _, err := fs.readRecord(next); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *FileStore) appendRecord(kind byte, payload []byte) (int64, error) {
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload)+crc32.Size)
+	record[0] = kind
+	record[1] = recordVersion
+	binary.BigEndian.PutUint32(record[2:], uint32(len(payload)))
+	record = append(record, payload...)
+	record = binary.BigEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+
+	offset := fs.size
+	if _, err := fs.file.WriteAt(record, offset); err != nil {
+		return 0, err
+	}
+	if err := fs.file.Sync(); err != nil {
+		return 0, err
+	}
+	fs.size += int64(len(record))
+	return offset, nil
+}
+
+func (fs *FileStore) readBlockRecord(offset int64) ([]byte, error) {
+	kind, version, payload, _, err := fs.readRecord(offset)
+	if err != nil {
+		return nil, err
+	}
+	if kind != recordBlock {
+		return nil, fmt.Errorf("record at offset %d is not a block", offset)
+	}
+	if err := checkRecordVersion(version); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func checkRecordVersion(version byte) error {
+	if version != recordVersion {
+		return fmt.Errorf("unsupported block record version %d", version)
+	}
+	return nil
+}
+
+func decodeHeaderPayload(version byte, payload []byte) (*BlockHeader, error) {
+	if err := checkRecordVersion(version); err != nil {
+		return nil, err
+	}
+	return DecodeBlockHeaderFromBlock(payload)
+}
+
+func (fs *FileStore) PutBlock(b *Block) error {
+	key := hex.EncodeToString(b.Hash())
+	if _, ok := fs.offsets[key]; ok {
+		return nil
+	}
+	offset, err := fs.appendRecord(recordBlock, EncodeBlock(b))
+	if err != nil {
+		return err
+	}
+	fs.offsets[key] = offset
+	return nil
+}
+
+func (fs *FileStore) GetBlock(hash []byte) (*Block, error) {
+	offset, ok := fs.offsets[hex.EncodeToString(hash)]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	payload, err := fs.readBlockRecord(offset)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBlock(payload)
+}
+
+func (fs *FileStore) GetHeader(hash []byte) (*BlockHeader, error) {
+	offset, ok := fs.offsets[hex.EncodeToString(hash)]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	payload, err := fs.readBlockRecord(offset)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBlockHeaderFromBlock(payload)
+}
+
+func (fs *FileStore) GetBlockByHeight(height uint64) (*Block, error) {
+	hash, err := fs.index.at(height)
+	if err != nil {
+		return nil, err
+	}
+	return fs.GetBlock(hash)
+}
+
+func (fs *FileStore) Head() (*Block, error) {
+	if fs.head == nil {
+		return nil, ErrBlockNotFound
+	}
+	return fs.GetBlock(fs.head)
+}
+
+func (fs *FileStore) SetHead(hash []byte) error {
+	if bytes.Equal(fs.head, hash) {
+		return nil
+	}
+	h, err := fs.GetHeader(hash)
+	if err != nil {
+		return err
+	}
+	index := fs.index.clone()
+	if err := index.rebuild(h, fs.GetHeader); err != nil {
+		return err
+	}
+	if _, err := fs.appendRecord(recordHead, hash); err != nil {
+		return err
+	}
+	fs.head = hash
+	fs.index = index
+	return nil
+}
+
+func (fs *FileStore) Iterate(fn func(*Block) error) error {
+	for _, hash := range fs.index.hashes {
+		b, err := fs.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeMetaRecord writes a metadata record payload: the key as a 32-bit
+// big-endian length followed by its bytes, then the value up to the end.
+func encodeMetaRecord(key string, value []byte) []byte {
+	payload := binary.BigEndian.AppendUint32(nil, uint32(len(key)))
+	payload = append(payload, key...)
+	return append(payload, value...)
+}
+
+func decodeMetaRecord(payload []byte) (string, []byte, error) {
+	if len(payload) < 4 || uint64(len(payload)-4) < uint64(binary.BigEndian.Uint32(payload)) {
+		return "", nil, errCorruptRecord
+	}
+	n := 4 + binary.BigEndian.Uint32(payload)
+	return string(payload[4:n]), append([]byte(nil), payload[n:]...), nil
+}
+
+func (fs *FileStore) PutMeta(key string, value []byte) error {
+	if _, err := fs.appendRecord(recordMeta, encodeMetaRecord(key, value)); err != nil {
+		return err
+	}
+	fs.meta[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (fs *FileStore) PutReceipts(hash []byte, receipts []*Receipt) error {
+	key := hex.EncodeToString(hash)
+	if _, ok := fs.receipts[key]; ok {
+		return nil
+	}
+	offset, err := fs.appendRecord(recordReceipts, encodeMetaRecord(string(hash), EncodeReceipts(receipts)))
+	if err != nil {
+		return err
+	}
+	fs.receipts[key] = offset
+	return nil
+}
+
+func (fs *FileStore) GetReceipts(hash []byte) ([]*Receipt, error) {
+	offset, ok := fs.receipts[hex.EncodeToString(hash)]
+	if !ok {
+		return nil, ErrReceiptsNotFound
+	}
+	kind, _, payload, _, err := fs.readRecord(offset)
+	if err != nil {
+		return nil, err
+	}
+	if kind != recordReceipts {
+		return nil, fmt.Errorf("record at offset %d is not a receipt list", offset)
+	}
+	_, data, err := decodeMetaRecord(payload)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeReceipts(data)
+}
+
+func (fs *FileStore) GetMeta(key string) ([]byte, error) {
+	value, ok := fs.meta[key]
+	if !ok {
+		return nil, ErrMetaNotFound
+	}
+	return value, nil
+}
+
+func (fs *FileStore) Close() error {
+	return fs.file.Close()
+}
@@ -0,0 +1,168 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newFileChain creates a store at a temporary path holding a genesis block
+// and two more blocks and returns the path, the hashes of the blocks and the
+// size of the file.
+func newFileChain(t *testing.T) (string, [][]byte, int64) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chain.db")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err := NewBlockchain(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := bc.CreateBlock(bc.LastBlock().Hash()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var hashes [][]byte
+	for _, b := range bc.Chain {
+		hashes = append(hashes, b.Hash())
+	}
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, hashes, info.Size()
+}
+
+// checkSize fails the test unless the file at path is size bytes long.
+func checkSize(t *testing.T, path string, size int64) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != size {
+		t.Fatalf("file is %d bytes, want %d", info.Size(), size)
+	}
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	path, hashes, _ := newFileChain(t)
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	bc, err := NewBlockchain(store, nil)
+	if err != nil {
+		t.Fatalf("NewBlockchain: %v", err)
+	}
+	defer bc.Close()
+
+	if len(bc.Chain) != len(hashes) || len(bc.undo) != len(hashes) {
+		t.Fatalf("reopened chain has %d blocks and %d undo records, want %d", len(bc.Chain), len(bc.undo), len(hashes))
+	}
+	for i, hash := range hashes {
+		if !bytes.Equal(bc.Chain[i].Hash(), hash) {
+			t.Errorf("block %d has hash %x, want %x", i, bc.Chain[i].Hash(), hash)
+		}
+		b, err := store.GetBlockByHeight(uint64(i))
+		if err != nil || !bytes.Equal(b.Hash(), hash) {
+			t.Errorf("GetBlockByHeight(%d) = %v, want block %x", i, err, hash)
+		}
+	}
+	if head, err := store.Head(); err != nil || !bytes.Equal(head.Hash(), hashes[len(hashes)-1]) {
+		t.Errorf("Head = %v, want block %x", err, hashes[len(hashes)-1])
+	}
+}
+
+func TestFileStoreDropsTornTail(t *testing.T) {
+	path, hashes, size := newFileChain(t)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The header of a block record claiming more payload than was written.
+	if _, err := file.Write([]byte{recordBlock, recordVersion, 0xff, 0xff, 0xff, 0xff, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	defer store.Close()
+	checkSize(t, path, size)
+	if head, err := store.Head(); err != nil || !bytes.Equal(head.Hash(), hashes[len(hashes)-1]) {
+		t.Fatalf("Head = %v, want block %x", err, hashes[len(hashes)-1])
+	}
+}
+
+func TestFileStoreRejectsDamagedRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(data []byte)
+	}{
+		{"flipped payload byte", func(data []byte) {
+			data[recordHeaderSize+10] ^= 0xff
+		}},
+		{"length past the end of the file", func(data []byte) {
+			binary.BigEndian.PutUint32(data[2:], 1<<30)
+		}},
+		{"length inside the file", func(data []byte) {
+			binary.BigEndian.PutUint32(data[2:], binary.BigEndian.Uint32(data[2:])+1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _, size := newFileChain(t)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Damage the first record, the genesis block.
+			tt.damage(data)
+			if err := os.WriteFile(path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = OpenFileStore(path)
+			if !errors.Is(err, errCorruptRecord) {
+				t.Fatalf("OpenFileStore: got %v, want %v", err, errCorruptRecord)
+			}
+			checkSize(t, path, size)
+		})
+	}
+}
+
+func TestFileStoreKeepsReceipts(t *testing.T) {
+	path, hashes, size := newFileChain(t)
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, hash := range hashes {
+		receipts, err := store.GetReceipts(hash)
+		if err != nil || len(receipts) != 0 {
+			t.Fatalf("GetReceipts(%x) = %d receipts, %v, want none of an empty block", hash, len(receipts), err)
+		}
+	}
+	if _, err := store.GetReceipts([]byte("missing")); !errors.Is(err, ErrReceiptsNotFound) {
+		t.Fatalf("GetReceipts of an unknown block: got %v, want %v", err, ErrReceiptsNotFound)
+	}
+
+	// Receipts are stored once per block; storing them again is a no-op.
+	if err := store.PutReceipts(hashes[1], []*Receipt{goldenReceipt()}); err != nil {
+		t.Fatalf("PutReceipts: %v", err)
+	}
+	checkSize(t, path, size)
+}
@@ -0,0 +1,275 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+var (
+	ErrInvalidPrecommit = errors.New("invalid precommit")
+	ErrNoQuorum         = errors.New("precommits do not reach two thirds of the authorities")
+	ErrFinalized        = errors.New("block conflicts with a finalized block")
+)
+
+// finalityMetaKey is the store metadata key the latest finality certificate
+// is kept under.
+const finalityMetaKey = "finality"
+
+// Precommit is an authority's signed statement that it considers a block
+// part of the chain for good. Once more than two thirds of the authorities
+// have precommitted to a block, the block and everything before it are
+// final: the chain will not be reorganised away from it.
+type Precommit struct {
+	Height    uint64
+	BlockHash []byte
+	// Authority is the address of the signing authority.
+	Authority string
+	// Signature is a wallet.Signature over SigningHash.
+	Signature []byte
+}
+
+// SigningHash returns the hash an authority signs: the canonical encoding of
+// every field except the signature. It uses its own encoding kind, so a
+// precommit signature can never pass as a block seal or the other way round.
+func (p *Precommit) SigningHash() []byte {
+	hash := sha256.Sum256(encodePrecommit(p, kindPrecommitSigning))
+	return hash[:]
+}
+
+// FinalityCertificate proves that a block is final: it holds the precommits
+// of more than two thirds of the authorities in force at the block.
+type FinalityCertificate struct {
+	Height     uint64
+	BlockHash  []byte
+	Precommits []*Precommit
+}
+
+// hasQuorum reports whether signers authorities out of total are more than
+// two thirds of them.
+func hasQuorum(signers int, total int) bool {
+	return 3*signers > 2*total
+}
+
+// SignPrecommit precommits to header with the authority wallet w.
+func (poa *PoA) SignPrecommit(w *wallet.Wallet, header *BlockHeader) (*Precommit, error) {
+	p := &Precommit{Height: header.Height, BlockHash: header.Hash(), Authority: w.Address}
+	signature, err := wallet.Sign(w.PrivateKey, p.SigningHash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign precommit: %w", err)
+	}
+	p.Signature = signature.Bytes()
+	return p, nil
+}
+
+// VerifyPrecommit checks that p was signed by an authority of snap, the
+// snapshot at the parent of the block p is for.
+func (poa *PoA) VerifyPrecommit(p *Precommit, snap *Snapshot) error {
+	authority, ok := snap.authority(p.Authority)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnauthorizedSigner, p.Authority)
+	}
+	signature, err := wallet.ParseSignature(p.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPrecommit, err)
+	}
+	if !signature.Verify(authority.PublicKey, p.SigningHash()) {
+		return fmt.Errorf("%w: bad signature from %s", ErrInvalidPrecommit, p.Authority)
+	}
+	return nil
+}
+
+// VerifyFinality checks that c carries valid precommits for its block from
+// more than two thirds of the authorities of snap, the snapshot at the
+// block's parent.
+func (poa *PoA) VerifyFinality(c *FinalityCertificate, snap *Snapshot) error {
+	signers := make(map[string]bool)
+	for _, p := range c.Precommits {
+		if p.Height != c.Height || string(p.BlockHash) != string(c.BlockHash) {
+			return fmt.Errorf("%w: precommit for another block", ErrInvalidPrecommit)
+		}
+		if err := poa.VerifyPrecommit(p, snap); err != nil {
+			return err
+		}
+		signers[p.Authority] = true
+	}
+	if !hasQuorum(len(signers), len(snap.Authorities)) {
+		return ErrNoQuorum
+	}
+	return nil
+}
+
+// Finalized returns the certificate of the latest finalized block, or nil if
+// nothing after genesis has been finalized.
+func (bc *Blockchain) Finalized() *FinalityCertificate {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.finalized
+}
+
+// FinalizedHeight returns the height of the latest finalized block. The
+// genesis block is always final.
+func (bc *Blockchain) FinalizedHeight() uint64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.finalizedHeight()
+}
+
+func (bc *Blockchain) finalizedHeight() uint64 {
+	if bc.finalized == nil {
+		return 0
+	}
+	return bc.finalized.Height
+}
+
+// SignPrecommit precommits to the block with the given hash with the Sealer
+// wallet, records the precommit and returns it so it can be sent to the
+// other authorities.
+func (bc *Blockchain) SignPrecommit(hash []byte) (*Precommit, error) {
+	bc.mu.Lock()
+	defer bc.unlock()
+	if bc.Sealer == nil {
+		return nil, ErrNoSealer
+	}
+	header, err := bc.store.GetHeader(hash)
+	if err != nil {
+		return nil, err
+	}
+	p, err := bc.Consensus.SignPrecommit(bc.Sealer, header)
+	if err != nil {
+		return nil, err
+	}
+	return p, bc.addPrecommit(p)
+}
+
+// AddPrecommit records a precommit from an authority. When the block it is
+// for gathers precommits from more than two thirds of the authorities, the
+// block is finalized: the chain is moved onto it if it is on a side branch,
+// and from then on no block at or below its height can be replaced.
+// Precommits for blocks at or below the finalized height are ignored.
+func (bc *Blockchain) AddPrecommit(p *Precommit) error {
+	bc.mu.Lock()
+	defer bc.unlock()
+	return bc.addPrecommit(p)
+}
+
+func (bc *Blockchain) addPrecommit(p *Precommit) error {
+	if bc.Consensus == nil {
+		return errors.New("chain has no consensus engine")
+	}
+	if p.Height <= bc.finalizedHeight() {
+		return nil
+	}
+	header, err := bc.store.GetHeader(p.BlockHash)
+	if err != nil {
+		return err
+	}
+	if header.Height != p.Height {
+		return fmt.Errorf("%w: block %x is at height %d, not %d", ErrInvalidPrecommit, p.BlockHash, header.Height, p.Height)
+	}
+	snap, err := bc.snapshot(header.PreviousHash)
+	if err != nil {
+		return err
+	}
+	if err := bc.Consensus.VerifyPrecommit(p, snap); err != nil {
+		return err
+	}
+
+	key := string(p.BlockHash)
+	if bc.precommits[key] == nil {
+		bc.precommits[key] = make(map[string]*Precommit)
+	}
+	bc.precommits[key][p.Authority] = p
+	if !hasQuorum(len(bc.precommits[key]), len(snap.Authorities)) {
+		return nil
+	}
+
+	c := &FinalityCertificate{Height: p.Height, BlockHash: p.BlockHash}
+	for _, precommit := range bc.precommits[key] {
+		c.Precommits = append(c.Precommits, precommit)
+	}
+	sort.Slice(c.Precommits, func(i, j int) bool { return c.Precommits[i].Authority < c.Precommits[j].Authority })
+	return bc.finalize(c)
+}
+
+// finalize makes the block of c the latest finalized block and persists c.
+func (bc *Blockchain) finalize(c *FinalityCertificate) error {
+	b, err := bc.store.GetBlock(c.BlockHash)
+	if err != nil {
+		return err
+	}
+	if !bc.isCanonical(b) {
+		if err := bc.reorg(b); err != nil {
+			return err
+		}
+	}
+	if err := bc.store.PutMeta(finalityMetaKey, EncodeFinalityCertificate(c)); err != nil {
+		return err
+	}
+	bc.finalized = c
+	for hash, precommits := range bc.precommits {
+		for _, p := range precommits {
+			if p.Height <= c.Height {
+				delete(bc.precommits, hash)
+			}
+			break // Every precommit for a block has the block's height.
+		}
+	}
+	return nil
+}
+
+// SetConsensus makes poa the consensus engine of the chain and loads the
+// latest finality certificate from the store. The certificate is only
+// trusted if its precommits reach a quorum of poa's authorities at the
+// block, so a damaged or forged store cannot pin the chain.
+func (bc *Blockchain) SetConsensus(poa *PoA) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.Consensus = poa
+	bc.snapshots = make(map[string]*Snapshot)
+	bc.weights = make(map[string]uint64)
+	return bc.loadFinality()
+}
+
+// loadFinality restores the latest finality certificate from the store and
+// checks it against the consensus engine. Without one there is nothing to
+// check it against and no finality.
+func (bc *Blockchain) loadFinality() error {
+	bc.finalized = nil
+	if bc.Consensus == nil {
+		return nil
+	}
+	data, err := bc.store.GetMeta(finalityMetaKey)
+	if errors.Is(err, ErrMetaNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c, err := DecodeFinalityCertificate(data)
+	if err != nil {
+		return fmt.Errorf("finality certificate: %w", err)
+	}
+	if err := bc.verifyFinality(c); err != nil {
+		return fmt.Errorf("finality certificate: %w", err)
+	}
+	bc.finalized = c
+	return nil
+}
+
+// verifyFinality checks that c is for a block of the canonical chain and
+// carries a quorum of valid precommits from the authorities at that block.
+func (bc *Blockchain) verifyFinality(c *FinalityCertificate) error {
+	if c.Height >= uint64(len(bc.Chain)) || !bytes.Equal(bc.Chain[c.Height].Hash(), c.BlockHash) {
+		return fmt.Errorf("block %x at height %d is not on the chain", c.BlockHash, c.Height)
+	}
+	snap, err := bc.snapshot(bc.Chain[c.Height].Header.PreviousHash)
+	if err != nil {
+		return err
+	}
+	return bc.Consensus.VerifyFinality(c, snap)
+}
@@ -0,0 +1,182 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+func TestHasQuorum(t *testing.T) {
+	tests := []struct {
+		total, signers int
+		want           bool
+	}{
+		{3, 1, false},
+		{3, 2, false},
+		{3, 3, true},
+		{4, 2, false},
+		{4, 3, true},
+		{4, 4, true},
+		{7, 4, false},
+		{7, 5, true},
+		{7, 7, true},
+	}
+	for _, tt := range tests {
+		if got := hasQuorum(tt.signers, tt.total); got != tt.want {
+			t.Errorf("hasQuorum(%d, %d) = %v, want %v", tt.signers, tt.total, got, tt.want)
+		}
+	}
+}
+
+// newFinalityChain returns a chain sealed in turn by the authorities ws, with
+// blocks up to the given height.
+func newFinalityChain(t *testing.T, store BlockStore, ws []*wallet.Wallet, height uint64) *Blockchain {
+	t.Helper()
+	bc, err := NewBlockchain(store, &Genesis{ChainID: testChainID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.SetConsensus(newTestPoA(ws...)); err != nil {
+		t.Fatal(err)
+	}
+	for h := uint64(1); h <= height; h++ {
+		b := blockOn(t, bc, ws[h%uint64(len(ws))], bc.LastBlock(), bc.state.Copy())
+		if err := bc.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return bc
+}
+
+// precommit returns the precommit of w to the block of bc at height.
+func precommit(t *testing.T, bc *Blockchain, w *wallet.Wallet, height uint64) *Precommit {
+	t.Helper()
+	p, err := bc.Consensus.SignPrecommit(w, &bc.Chain[height].Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAddPrecommitFinalizes(t *testing.T) {
+	ws := rotation(t, 3)
+	bc := newFinalityChain(t, NewMemoryStore(), ws, 2)
+
+	forged := precommit(t, bc, ws[0], 2)
+	forged.Signature = precommit(t, bc, ws[1], 2).Signature
+	if err := bc.AddPrecommit(forged); !errors.Is(err, ErrInvalidPrecommit) {
+		t.Fatalf("AddPrecommit with another authority's signature: got %v, want %v", err, ErrInvalidPrecommit)
+	}
+	stranger := newAuthority(t)
+	if err := bc.AddPrecommit(precommit(t, bc, stranger, 2)); !errors.Is(err, ErrUnauthorizedSigner) {
+		t.Fatalf("AddPrecommit from a stranger: got %v, want %v", err, ErrUnauthorizedSigner)
+	}
+
+	// Two of three authorities are not more than two thirds, even if one of
+	// them precommits twice.
+	for _, w := range []*wallet.Wallet{ws[0], ws[1], ws[1]} {
+		if err := bc.AddPrecommit(precommit(t, bc, w, 2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bc.FinalizedHeight() != 0 || bc.Finalized() != nil {
+		t.Fatalf("block 2 is final with two of three precommits")
+	}
+	if err := bc.AddPrecommit(precommit(t, bc, ws[2], 2)); err != nil {
+		t.Fatal(err)
+	}
+	if bc.FinalizedHeight() != 2 || len(bc.Finalized().Precommits) != 3 {
+		t.Fatalf("finalized height %d with %v, want 2 with three precommits", bc.FinalizedHeight(), bc.Finalized())
+	}
+
+	// A heavier branch from below the finalized block is kept out.
+	state := NewState()
+	state.ApplyBlock(bc.Chain[1])
+	var err error
+	parent := bc.Chain[1]
+	for h := uint64(2); h <= 4; h++ {
+		b := blockOn(t, bc, ws[h%3], parent, state)
+		err = bc.AddBlock(b)
+		if h == 2 && !errors.Is(err, ErrFinalized) {
+			t.Fatalf("side block at the finalized height: got %v, want %v", err, ErrFinalized)
+		}
+		parent = b
+		if h == 2 {
+			// Store it anyway, the way a block synced before the finality
+			// certificate would have been.
+			if err := bc.store.PutBlock(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if !errors.Is(err, ErrFinalized) {
+		t.Fatalf("heavier branch below the finalized block: got %v, want %v", err, ErrFinalized)
+	}
+	if bc.LastBlock().Header.Height != 2 {
+		t.Fatalf("head moved to height %d", bc.LastBlock().Header.Height)
+	}
+}
+
+func TestSetConsensusChecksFinalityCertificate(t *testing.T) {
+	ws := rotation(t, 4)
+	store := NewMemoryStore()
+	bc := newFinalityChain(t, store, ws, 2)
+	for _, w := range ws[:3] {
+		if err := bc.AddPrecommit(precommit(t, bc, w, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	valid := bc.Finalized()
+	if valid == nil || valid.Height != 1 {
+		t.Fatalf("finalized %v, want block 1", valid)
+	}
+
+	reopen := func(c *FinalityCertificate) error {
+		t.Helper()
+		if err := store.PutMeta(finalityMetaKey, EncodeFinalityCertificate(c)); err != nil {
+			t.Fatal(err)
+		}
+		bc, err := NewBlockchain(store, &Genesis{ChainID: testChainID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.SetConsensus(newTestPoA(ws...)); err != nil {
+			return err
+		}
+		if bc.FinalizedHeight() != c.Height {
+			t.Fatalf("reopened chain is finalized at %d, want %d", bc.FinalizedHeight(), c.Height)
+		}
+		return nil
+	}
+	if err := reopen(valid); err != nil {
+		t.Fatalf("SetConsensus with the stored certificate: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *FinalityCertificate)
+		want   error
+	}{
+		{"too few precommits", func(c *FinalityCertificate) { c.Precommits = c.Precommits[:2] }, ErrNoQuorum},
+		{"precommit counted twice", func(c *FinalityCertificate) { c.Precommits[2] = c.Precommits[1] }, ErrNoQuorum},
+		{"forged signature", func(c *FinalityCertificate) {
+			forged := *c.Precommits[0]
+			forged.Signature = c.Precommits[1].Signature
+			c.Precommits[0] = &forged
+		}, ErrInvalidPrecommit},
+		{"moved to another block", func(c *FinalityCertificate) {
+			c.Height, c.BlockHash = 2, bc.Chain[2].Hash()
+		}, ErrInvalidPrecommit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *valid
+			c.Precommits = append([]*Precommit(nil), valid.Precommits...)
+			tt.modify(&c)
+			if err := reopen(&c); !errors.Is(err, tt.want) {
+				t.Fatalf("SetConsensus: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
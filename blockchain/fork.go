@@ -0,0 +1,269 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Weights a block adds to its chain under PoA. Fork choice follows the
+// heaviest chain, so of two branches of the same length the one sealed more
+// often by the authority in turn wins, and a branch built by a few authorities
+// stepping in for the others loses to one the full rotation agrees on.
+const (
+	InTurnWeight    = 2
+	OutOfTurnWeight = 1
+)
+
+var (
+	ErrKnownBlock    = errors.New("block is already known")
+	ErrUnknownParent = errors.New("parent block is not known")
+	ErrInvalidParent = errors.New("parent block is invalid")
+	ErrForkedGenesis = errors.New("branch does not share the genesis block")
+)
+
+// ReorgEvent describes a switch of the canonical chain to another branch.
+type ReorgEvent struct {
+	OldHead []byte
+	NewHead []byte
+	// Ancestor is the height of the last block both branches share.
+	Ancestor uint64
+	// Removed are the blocks that left the canonical chain and Added the
+	// blocks that joined it, both in height order.
+	Removed []*Block
+	Added   []*Block
+	// Orphaned are the transactions of Removed that are not in Added. They
+	// are offered back to the pool, which drops the ones that no longer
+	// apply.
+	Orphaned []*Transactions
+}
+
+// SubscribeReorg registers fn to be called after every reorganisation of
+// the chain. fn is called synchronously by the call that caused the
+// reorganisation, once the new head is in place and the chain is unlocked,
+// so it may use the chain's methods.
+func (bc *Blockchain) SubscribeReorg(fn func(ReorgEvent)) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.reorgSubscribers = append(bc.reorgSubscribers, fn)
+}
+
+// blockWeight returns what h adds to the weight of its chain. Without a
+// consensus engine every block weighs the same and the longest chain wins.
+func (bc *Blockchain) blockWeight(h *BlockHeader) (uint64, error) {
+	if bc.Consensus == nil {
+		return OutOfTurnWeight, nil
+	}
+	snap, err := bc.snapshot(h.PreviousHash)
+	if err != nil {
+		return 0, err
+	}
+	if bc.Consensus.InTurn(h, snap) {
+		return InTurnWeight, nil
+	}
+	return OutOfTurnWeight, nil
+}
+
+// Weight returns the total weight of the chain that ends at the block with
+// the given hash: the sum of the weights of its blocks after genesis.
+func (bc *Blockchain) Weight(hash []byte) (uint64, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.weight(hash)
+}
+
+func (bc *Blockchain) weight(hash []byte) (uint64, error) {
+	var headers []*BlockHeader
+	var total uint64
+	for {
+		if weight, ok := bc.cachedWeight(hash); ok {
+			total = weight
+			break
+		}
+		h, err := bc.store.GetHeader(hash)
+		if err != nil {
+			return 0, err
+		}
+		if h.Height == 0 {
+			bc.cacheWeight(hash, 0)
+			break
+		}
+		headers = append(headers, h)
+		hash = h.PreviousHash
+	}
+
+	for i := len(headers) - 1; i >= 0; i-- {
+		weight, err := bc.blockWeight(headers[i])
+		if err != nil {
+			return 0, err
+		}
+		total += weight
+		bc.cacheWeight(headers[i].Hash(), total)
+	}
+	return total, nil
+}
+
+func (bc *Blockchain) cachedWeight(hash []byte) (uint64, bool) {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	weight, ok := bc.weights[string(hash)]
+	return weight, ok
+}
+
+func (bc *Blockchain) cacheWeight(hash []byte, weight uint64) {
+	bc.cacheMu.Lock()
+	defer bc.cacheMu.Unlock()
+	bc.weights[string(hash)] = weight
+}
+
+// isCanonical reports whether b is the canonical block at its height.
+func (bc *Blockchain) isCanonical(b *Block) bool {
+	height := b.Header.Height
+	return height < uint64(len(bc.Chain)) && bytes.Equal(bc.Chain[height].Hash(), b.Hash())
+}
+
+// addSideBlock stores a block that does not extend the head. Its header and
+// body are checked against its parent, but whether it applies to the state
+// is only known once its branch becomes the heaviest, at which point the
+// chain is reorganised onto it.
+func (bc *Blockchain) addSideBlock(b *Block) error {
+	if b.Header.Height <= bc.finalizedHeight() {
+		return fmt.Errorf("%w at height %d", ErrFinalized, bc.finalizedHeight())
+	}
+	parent, err := bc.store.GetBlock(b.Header.PreviousHash)
+	if errors.Is(err, ErrBlockNotFound) {
+		return fmt.Errorf("%w: %x", ErrUnknownParent, b.Header.PreviousHash)
+	}
+	if err != nil {
+		return err
+	}
+	if err := bc.validateBlock(b, parent); err != nil {
+		return err
+	}
+	if err := bc.store.PutBlock(b); err != nil {
+		return err
+	}
+
+	weight, err := bc.weight(b.Hash())
+	if err != nil {
+		return err
+	}
+	headWeight, err := bc.weight(bc.lastBlock().Hash())
+	if err != nil {
+		return err
+	}
+	if weight <= headWeight {
+		return nil // Ties keep the branch that was there first.
+	}
+	return bc.reorg(b)
+}
+
+// reorg makes the branch ending at head canonical. It never removes a
+// finalized block. The state is stepped back to the last block the branches
+// share with the undo records of the blocks leaving the chain, and the new
+// branch applied on top of it; if one of its blocks does not apply, that block
+// and the ones after it are marked invalid and the chain stays as it was.
+// Transactions of the old branch that the new one does not include go back to
+// the pool.
+func (bc *Blockchain) reorg(head *Block) error {
+	var branch []*Block
+	for b := head; !bc.isCanonical(b); {
+		if b.Header.Height == 0 {
+			return ErrForkedGenesis
+		}
+		branch = append(branch, b)
+		parent, err := bc.store.GetBlock(b.Header.PreviousHash)
+		if err != nil {
+			return err
+		}
+		b = parent
+	}
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	ancestor := branch[0].Header.Height - 1
+	if ancestor < bc.finalizedHeight() {
+		return fmt.Errorf("%w at height %d", ErrFinalized, bc.finalizedHeight())
+	}
+
+	state := bc.state.Copy()
+	for i := len(bc.Chain) - 1; i > int(ancestor); i-- {
+		state.revert(bc.undo[i])
+	}
+	undo := make([]stateUndo, len(branch))
+	receipts := make([][]*Receipt, len(branch))
+	for i, b := range branch {
+		next := state.Copy()
+		var err error
+		receipts[i], err = executeChecked(b, next)
+		if err != nil {
+			for _, bad := range branch[i:] {
+				bc.invalid[string(bad.Hash())] = err
+			}
+			return err
+		}
+		undo[i] = state.undoTo(next)
+		state = next
+	}
+	for i, b := range branch {
+		if err := bc.store.PutReceipts(b.Hash(), receipts[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := bc.store.SetHead(head.Hash()); err != nil {
+		return err
+	}
+	event := ReorgEvent{
+		OldHead:  bc.lastBlock().Hash(),
+		NewHead:  head.Hash(),
+		Ancestor: ancestor,
+		Removed:  bc.Chain[ancestor+1:],
+		Added:    branch,
+	}
+	for i := len(event.Removed) - 1; i >= 0; i-- {
+		bc.index.remove(event.Removed[i])
+	}
+	bc.Chain = bc.Chain[: ancestor+1 : ancestor+1]
+	bc.undo = bc.undo[: ancestor+1 : ancestor+1]
+	for i, b := range branch {
+		bc.appendCanonical(b, undo[i])
+	}
+	bc.state = state
+
+	included := make(map[string]bool)
+	for _, b := range branch {
+		for i := range b.Transactions {
+			included[string(b.Transactions[i].ID())] = true
+		}
+	}
+	for _, b := range event.Removed {
+		for i := range b.Transactions {
+			tx := &b.Transactions[i]
+			if !included[string(tx.ID())] {
+				event.Orphaned = append(event.Orphaned, tx)
+				bc.Pool.Add(newPoolTx(tx))
+			}
+		}
+	}
+	for _, b := range branch {
+		bc.removeIncluded(b)
+	}
+
+	bc.reorgs = append(bc.reorgs, event)
+	return nil
+}
+
+// unlock releases the exclusive lock of a call that may have reorganised the
+// chain and then tells the subscribers about the reorganisations, so they
+// see the chain as the call left it and may use its methods.
+func (bc *Blockchain) unlock() {
+	reorgs, subscribers := bc.reorgs, bc.reorgSubscribers
+	bc.reorgs = nil
+	bc.mu.Unlock()
+	for _, event := range reorgs {
+		for _, fn := range subscribers {
+			fn(event)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// blockOn returns a block on top of parent holding txs, sealed by w, with
+// its roots filled in. state is the state at parent; it is moved on to the
+// state after the block, as far as txs apply.
+func blockOn(t *testing.T, bc *Blockchain, w *wallet.Wallet, parent *Block, state *State, txs ...Transactions) *Block {
+	t.Helper()
+	b := NewBlock(parent.Hash(), txs)
+	b.Header.Height = parent.Header.Height + 1
+	receipts, _ := state.ExecuteBlock(b)
+	b.Header.StateRoot = state.Root()
+	b.Header.ReceiptsRoot = ReceiptsRoot(receipts)
+	seal(t, bc, w, b)
+	return b
+}
+
+// hashes returns the hashes of bs.
+func hashes(bs []*Block) [][]byte {
+	var hs [][]byte
+	for _, b := range bs {
+		hs = append(hs, b.Hash())
+	}
+	return hs
+}
+
+func sameHashes(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHead fails the test unless the chain and its store end at head and
+// the state is the one head commits to.
+func checkHead(t *testing.T, bc *Blockchain, head *Block) {
+	t.Helper()
+	if !bytes.Equal(bc.LastBlock().Hash(), head.Hash()) {
+		t.Fatalf("head is block %d (%x), want block %d (%x)", bc.LastBlock().Header.Height, bc.LastBlock().Hash(), head.Header.Height, head.Hash())
+	}
+	if stored, err := bc.store.Head(); err != nil || !bytes.Equal(stored.Hash(), head.Hash()) {
+		t.Fatalf("store head = %v, want block %x", err, head.Hash())
+	}
+	if !bytes.Equal(bc.state.Root(), head.Header.StateRoot) {
+		t.Fatalf("state root = %x, head commits to %x", bc.state.Root(), head.Header.StateRoot)
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestReorgToHeavierBranch(t *testing.T) {
+	bc := newFundedChain(t)
+	var events []ReorgEvent
+	bc.SubscribeReorg(func(e ReorgEvent) { events = append(events, e) })
+	fork := bc.LastBlock()
+	forkState := bc.state.Copy()
+
+	// The canonical branch pays bob from alice.
+	transfer := signedTransfer(t, aliceWallet, 0, bob, 3*amountScale)
+	if err := bc.AddTransaction(transfer); err != nil {
+		t.Fatal(err)
+	}
+	a2, err := bc.CreateBlock(fork.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A side branch mints to bob instead. As long as it is no heavier the
+	// chain stays where it is.
+	sideState := forkState.Copy()
+	b2 := blockOn(t, bc, bc.Sealer, fork, sideState, *NewTransaction(testChainID, 0, nil, bob, 5*amountScale))
+	if err := bc.AddBlock(b2); err != nil {
+		t.Fatalf("AddBlock(b2): %v", err)
+	}
+	checkHead(t, bc, a2)
+	if len(events) != 0 {
+		t.Fatalf("a tie reorganised the chain: %+v", events)
+	}
+
+	b3 := blockOn(t, bc, bc.Sealer, b2, sideState)
+	if err := bc.AddBlock(b3); err != nil {
+		t.Fatalf("AddBlock(b3): %v", err)
+	}
+	checkHead(t, bc, b3)
+	if len(events) != 1 {
+		t.Fatalf("got %d reorg events, want 1", len(events))
+	}
+	e := events[0]
+	if !bytes.Equal(e.OldHead, a2.Hash()) || !bytes.Equal(e.NewHead, b3.Hash()) || e.Ancestor != fork.Header.Height {
+		t.Errorf("event moves from %x to %x over %d, want %x to %x over %d", e.OldHead, e.NewHead, e.Ancestor, a2.Hash(), b3.Hash(), fork.Header.Height)
+	}
+	if !sameHashes(hashes(e.Removed), hashes([]*Block{a2})) || !sameHashes(hashes(e.Added), hashes([]*Block{b2, b3})) {
+		t.Errorf("event removes %x and adds %x", hashes(e.Removed), hashes(e.Added))
+	}
+	if len(e.Orphaned) != 1 || !bytes.Equal(e.Orphaned[0].ID(), transfer.ID()) {
+		t.Errorf("event orphans %v, want the transfer", e.Orphaned)
+	}
+
+	// The transfer is undone, the mint applied, and the transfer is
+	// pending again.
+	if got := bc.BalanceOf(alice); got != 10*amountScale {
+		t.Errorf("alice has %s, want 10.00", got)
+	}
+	if got := bc.BalanceOf(bob); got != 5*amountScale {
+		t.Errorf("bob has %s, want 5.00", got)
+	}
+	if got := bc.state.NonceOf(alice); got != 0 {
+		t.Errorf("alice is at nonce %d, want 0", got)
+	}
+	if pending := bc.PendingTransactions(); len(pending) != 1 || !bytes.Equal(pending[0].ID(), transfer.ID()) {
+		t.Errorf("pool holds %v, want the orphaned transfer", pending)
+	}
+
+	// The first branch catching up and overtaking switches back, returning
+	// the mint to the pool and taking the transfer out of it.
+	mainState := forkState.Copy()
+	mainState.ApplyBlock(a2)
+	a3 := blockOn(t, bc, bc.Sealer, a2, mainState)
+	if err := bc.AddBlock(a3); err != nil {
+		t.Fatalf("AddBlock(a3): %v", err)
+	}
+	a4 := blockOn(t, bc, bc.Sealer, a3, mainState)
+	if err := bc.AddBlock(a4); err != nil {
+		t.Fatalf("AddBlock(a4): %v", err)
+	}
+	checkHead(t, bc, a4)
+	if len(events) != 2 || !sameHashes(hashes(events[1].Removed), hashes([]*Block{b2, b3})) {
+		t.Fatalf("second reorg not reported as removing b2 and b3: %+v", events[1:])
+	}
+	if got := bc.BalanceOf(bob); got != 3*amountScale {
+		t.Errorf("bob has %s, want 3.00", got)
+	}
+	if pending := bc.PendingTransactions(); len(pending) != 1 || !pending[0].IsMint() {
+		t.Errorf("pool holds %v, want the orphaned mint", pending)
+	}
+}
+
+func TestReorgPrefersInTurnBlocks(t *testing.T) {
+	ws := rotation(t, 2)
+	bc := newTestChain(t)
+	bc.Consensus = newTestPoA(ws...)
+	genesis := bc.LastBlock()
+
+	// Block 1 is ws[1]'s turn.
+	outOfTurn := blockOn(t, bc, ws[0], genesis, bc.state.Copy())
+	if err := bc.AddBlock(outOfTurn); err != nil {
+		t.Fatal(err)
+	}
+	inTurn := blockOn(t, bc, ws[1], genesis, bc.state.Copy())
+	if err := bc.AddBlock(inTurn); err != nil {
+		t.Fatal(err)
+	}
+	checkHead(t, bc, inTurn)
+	for _, c := range []struct {
+		b    *Block
+		want uint64
+	}{{outOfTurn, OutOfTurnWeight}, {inTurn, InTurnWeight}} {
+		if got, err := bc.Weight(c.b.Hash()); err != nil || got != c.want {
+			t.Errorf("Weight(%x) = %d, %v, want %d", c.b.Hash(), got, err, c.want)
+		}
+	}
+}
+
+func TestReorgRejectsBranchThatDoesNotApply(t *testing.T) {
+	bc := newFundedChain(t)
+	fork := bc.LastBlock()
+	forkState := bc.state.Copy()
+	head, err := bc.CreateBlock(fork.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []ReorgEvent
+	bc.SubscribeReorg(func(e ReorgEvent) { events = append(events, e) })
+
+	sideState := forkState.Copy()
+	c2 := blockOn(t, bc, bc.Sealer, fork, sideState)
+	if err := bc.AddBlock(c2); err != nil {
+		t.Fatalf("AddBlock(c2): %v", err)
+	}
+	c3 := blockOn(t, bc, bc.Sealer, c2, sideState, *signedTransfer(t, aliceWallet, 0, bob, 20*amountScale))
+	if err := bc.AddBlock(c3); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("AddBlock(c3): got %v, want %v", err, ErrInsufficientFunds)
+	}
+	c4 := blockOn(t, bc, bc.Sealer, c3, sideState)
+	if err := bc.AddBlock(c4); !errors.Is(err, ErrInvalidParent) {
+		t.Fatalf("AddBlock(c4): got %v, want %v", err, ErrInvalidParent)
+	}
+	checkHead(t, bc, head)
+	if len(events) != 0 {
+		t.Fatalf("failed reorg was reported: %+v", events)
+	}
+}
+
+func TestAddBlockRejectsUnlinkedBlocks(t *testing.T) {
+	bc := newFundedChain(t)
+	if err := bc.AddBlock(bc.LastBlock()); !errors.Is(err, ErrKnownBlock) {
+		t.Fatalf("AddBlock(head): got %v, want %v", err, ErrKnownBlock)
+	}
+	b := childBlock(bc)
+	b.Header.PreviousHash = bytes.Repeat([]byte{1}, 32)
+	if err := bc.AddBlock(b); !errors.Is(err, ErrUnknownParent) {
+		t.Fatalf("AddBlock with an unknown parent: got %v, want %v", err, ErrUnknownParent)
+	}
+	// The link itself is still checked when a block is validated against a
+	// parent it does not name.
+	if err := bc.ValidateBlock(b, bc.LastBlock()); !errors.Is(err, ErrBadLink) {
+		t.Fatalf("ValidateBlock: got %v, want %v", err, ErrBadLink)
+	}
+}
@@ -0,0 +1,267 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+var (
+	ErrInvalidGenesis  = errors.New("invalid genesis spec")
+	ErrGenesisMismatch = errors.New("stored genesis block does not match the genesis spec")
+)
+
+// Genesis describes how a network starts: its chain ID, the authorities that
+// may seal blocks, the PoA schedule and the balances that exist before the
+// first block. Every node that starts from the same spec builds the same
+// genesis block, byte for byte.
+type Genesis struct {
+	ChainID string
+	// Timestamp is the time of the genesis block. The zero time stands for
+	// the Unix epoch.
+	Timestamp time.Time
+	// Authorities are the public keys of the initial authorities. With no
+	// authorities the chain runs without consensus.
+	Authorities []*ecdsa.PublicKey
+	// Period and OutOfTurnDelay configure the PoA schedule. Zero means
+	// DefaultBlockPeriod and DefaultOutOfTurnDelay.
+	Period         time.Duration
+	OutOfTurnDelay time.Duration
+	// Alloc lists the initial balances, for example of a treasury. Each
+	// becomes a mint in the genesis block.
+	Alloc []GenesisAlloc
+}
+
+// GenesisAlloc is an initial balance. Address is the public key hash of the
+// account, as in Transactions.RecipientHash.
+type GenesisAlloc struct {
+	Address []byte
+	Balance Amount
+}
+
+// timestamp returns the genesis time in Unix nanoseconds. The zero time is
+// the Unix epoch.
+func (g *Genesis) timestamp() uint64 {
+	if g.Timestamp.IsZero() {
+		return 0
+	}
+	return uint64(g.Timestamp.UnixNano())
+}
+
+func (g *Genesis) period() time.Duration {
+	if g.Period == 0 {
+		return DefaultBlockPeriod
+	}
+	return g.Period
+}
+
+func (g *Genesis) outOfTurnDelay() time.Duration {
+	if g.OutOfTurnDelay == 0 {
+		return DefaultOutOfTurnDelay
+	}
+	return g.OutOfTurnDelay
+}
+
+// Validate checks that the spec can produce a genesis block.
+func (g *Genesis) Validate() error {
+	if g.Period < 0 || g.OutOfTurnDelay < 0 {
+		return fmt.Errorf("%w: negative consensus delay", ErrInvalidGenesis)
+	}
+	if !g.Timestamp.IsZero() && (g.Timestamp.Unix() < 0 || g.Timestamp.Year() > 2262) {
+		return fmt.Errorf("%w: timestamp outside 1970 to 2262", ErrInvalidGenesis)
+	}
+	keys := make(map[string]bool)
+	for _, key := range g.Authorities {
+		k := string(wallet.PublicKeyToFixedBytes(key))
+		if keys[k] {
+			return fmt.Errorf("%w: duplicate authority %s", ErrInvalidGenesis, wallet.GenerateAddress(key))
+		}
+		keys[k] = true
+	}
+	addresses := make(map[string]bool)
+	var total Amount
+	for _, alloc := range g.Alloc {
+		if len(alloc.Address) == 0 {
+			return fmt.Errorf("%w: allocation without an address", ErrInvalidGenesis)
+		}
+		if addresses[string(alloc.Address)] {
+			return fmt.Errorf("%w: duplicate allocation for %x", ErrInvalidGenesis, alloc.Address)
+		}
+		if alloc.Balance == 0 {
+			return fmt.Errorf("%w: zero allocation for %x", ErrInvalidGenesis, alloc.Address)
+		}
+		addresses[string(alloc.Address)] = true
+		var err error
+		if total, err = total.Add(alloc.Balance); err != nil {
+			return fmt.Errorf("%w: allocations add up to more than %v", ErrInvalidGenesis, Amount(math.MaxUint64))
+		}
+	}
+	return nil
+}
+
+// PoA returns a consensus engine for the spec's authorities and schedule, or
+// nil if the spec has no authorities.
+func (g *Genesis) PoA() *PoA {
+	if len(g.Authorities) == 0 {
+		return nil
+	}
+	poa := NewPoA(g.Authorities)
+	poa.Period = g.period()
+	poa.OutOfTurnDelay = g.outOfTurnDelay()
+	return poa
+}
+
+// sortedAlloc returns the allocations ordered by address.
+func (g *Genesis) sortedAlloc() []GenesisAlloc {
+	alloc := append([]GenesisAlloc(nil), g.Alloc...)
+	sort.Slice(alloc, func(i, j int) bool { return bytes.Compare(alloc[i].Address, alloc[j].Address) < 0 })
+	return alloc
+}
+
+// Hash returns the SHA-256 of the canonical encoding of the spec.
+func (g *Genesis) Hash() []byte {
+	hash := sha256.Sum256(EncodeGenesis(g))
+	return hash[:]
+}
+
+// Block builds the genesis block. Its previous hash is the SHA-256 of
+// GENESIS_STRING followed by the spec hash, so the block commits to the whole
+// spec, authorities and schedule included, and not only to what is in its
+// header and transactions.
+//
+// The block and its mints are of the current BlockVersion and
+// TransactionVersion, like every other block, since a node accepts no other
+// versions. A release that bumps either version therefore changes the
+// genesis block of every spec and starts new networks.
+func (g *Genesis) Block() (*Block, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	timestamp := g.timestamp()
+	previous := sha256.Sum256(append([]byte(GENESIS_STRING), g.Hash()...))
+
+	b := &Block{Header: BlockHeader{
+		Version:      BlockVersion,
+		PreviousHash: previous[:],
+		Timestamp:    timestamp,
+	}}
+	for _, alloc := range g.sortedAlloc() {
+		b.Transactions = append(b.Transactions, Transactions{
+			Version:       TransactionVersion,
+			ChainID:       g.ChainID,
+			RecipientHash: alloc.Address,
+			Value:         alloc.Balance,
+			Timestamp:     timestamp,
+		})
+	}
+	state := NewState()
+	receipts, err := state.ExecuteBlock(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGenesis, err)
+	}
+	b.Header.MerkleRoot = b.MerkleTree().CalculateMerkleRoot()
+	b.Header.StateRoot = state.Root()
+	b.Header.ReceiptsRoot = ReceiptsRoot(receipts)
+	return b, nil
+}
+
+type genesisJSON struct {
+	ChainID     string            `json:"chain_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Authorities []string          `json:"authorities"`
+	Consensus   genesisPoAJSON    `json:"consensus"`
+	Alloc       map[string]Amount `json:"alloc"`
+}
+
+type genesisPoAJSON struct {
+	Period         string `json:"period,omitempty"`
+	OutOfTurnDelay string `json:"out_of_turn_delay,omitempty"`
+}
+
+// MarshalJSON writes authorities as hex public keys in the fixed 64-byte
+// form, allocations keyed by wallet address and delays as Go durations.
+func (g *Genesis) MarshalJSON() ([]byte, error) {
+	v := genesisJSON{
+		ChainID:     g.ChainID,
+		Timestamp:   g.Timestamp.UTC(),
+		Authorities: make([]string, len(g.Authorities)),
+		Consensus: genesisPoAJSON{
+			Period:         g.period().String(),
+			OutOfTurnDelay: g.outOfTurnDelay().String(),
+		},
+		Alloc: make(map[string]Amount),
+	}
+	for i, key := range g.Authorities {
+		v.Authorities[i] = hex.EncodeToString(wallet.PublicKeyToFixedBytes(key))
+	}
+	for _, alloc := range g.Alloc {
+		v.Alloc[wallet.AddressFromPubKeyHash(alloc.Address)] = alloc.Balance
+	}
+	return json.Marshal(v)
+}
+
+func (g *Genesis) UnmarshalJSON(data []byte) error {
+	var v genesisJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	spec := Genesis{ChainID: v.ChainID, Timestamp: v.Timestamp}
+	for _, s := range v.Authorities {
+		raw, err := hex.DecodeString(s)
+		if err != nil || len(raw) != 64 {
+			return fmt.Errorf("%w: authority %q is not a 64-byte hex public key", ErrInvalidGenesis, s)
+		}
+		key, err := wallet.BytesToPublicKey(raw)
+		if err != nil {
+			return fmt.Errorf("%w: authority %q: %v", ErrInvalidGenesis, s, err)
+		}
+		spec.Authorities = append(spec.Authorities, key)
+	}
+	var err error
+	if v.Consensus.Period != "" {
+		if spec.Period, err = time.ParseDuration(v.Consensus.Period); err != nil {
+			return fmt.Errorf("%w: period: %v", ErrInvalidGenesis, err)
+		}
+	}
+	if v.Consensus.OutOfTurnDelay != "" {
+		if spec.OutOfTurnDelay, err = time.ParseDuration(v.Consensus.OutOfTurnDelay); err != nil {
+			return fmt.Errorf("%w: out_of_turn_delay: %v", ErrInvalidGenesis, err)
+		}
+	}
+	for address, balance := range v.Alloc {
+		hash, err := wallet.PubKeyFromAddress(address)
+		if err != nil {
+			return fmt.Errorf("%w: alloc address %q: %v", ErrInvalidGenesis, address, err)
+		}
+		spec.Alloc = append(spec.Alloc, GenesisAlloc{Address: hash, Balance: balance})
+	}
+	spec.Alloc = spec.sortedAlloc()
+	*g = spec
+	return nil
+}
+
+// LoadGenesis reads a genesis spec from a JSON file.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	g := &Genesis{}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, fmt.Errorf("genesis %s: %w", path, err)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, fmt.Errorf("genesis %s: %w", path, err)
+	}
+	return g, nil
+}
@@ -0,0 +1,179 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// The hashes of testdata/genesis.json, a copy of docs/genesis.example.json,
+// and of the empty spec, as listed in docs/genesis.md.
+const (
+	goldenGenesisSpecHash  = "6476048a399221ceb30f86f619d38f37ee8b9a373ab61ba5069439ea08ee822f"
+	goldenGenesisHash      = "3b72e6a2542700ec04df392df972638e626c931e9f638b918d0c463a568c9db8"
+	goldenEmptyGenesisHash = "28ddd539d99aa6f7c6eb49cdae0867829b9d3f2fd99d949b6cd5db758e1f39e8"
+)
+
+// genesisBlock returns the genesis block of g and fails the test if g is
+// invalid.
+func genesisBlock(t *testing.T, g *Genesis) *Block {
+	t.Helper()
+	b, err := g.Block()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestGenesisVectors(t *testing.T) {
+	g, err := LoadGenesis(filepath.Join("testdata", "genesis.json"))
+	if err != nil {
+		t.Fatalf("LoadGenesis: %v", err)
+	}
+	if got := hex.EncodeToString(g.Hash()); got != goldenGenesisSpecHash {
+		t.Errorf("spec hash = %s, want %s", got, goldenGenesisSpecHash)
+	}
+	if got := hex.EncodeToString(genesisBlock(t, g).Hash()); got != goldenGenesisHash {
+		t.Errorf("genesis hash = %s, want %s", got, goldenGenesisHash)
+	}
+	if got := hex.EncodeToString(genesisBlock(t, &Genesis{}).Hash()); got != goldenEmptyGenesisHash {
+		t.Errorf("empty genesis hash = %s, want %s", got, goldenEmptyGenesisHash)
+	}
+
+	// Writing the spec out and reading it back, with the defaults filled in,
+	// gives the same block.
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Genesis
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(genesisBlock(t, &back).Hash()); got != goldenGenesisHash {
+		t.Errorf("genesis hash after a JSON round trip = %s, want %s", got, goldenGenesisHash)
+	}
+}
+
+func TestGenesisIgnoresOrderAndDefaults(t *testing.T) {
+	ws := rotation(t, 3)
+	g := &Genesis{
+		ChainID:     testChainID,
+		Authorities: keys(ws...),
+		Alloc:       []GenesisAlloc{{Address: alice, Balance: 10}, {Address: bob, Balance: 20}},
+	}
+	same := &Genesis{
+		ChainID:        testChainID,
+		Authorities:    keys(ws[2], ws[0], ws[1]),
+		Period:         DefaultBlockPeriod,
+		OutOfTurnDelay: DefaultOutOfTurnDelay,
+		Alloc:          []GenesisAlloc{{Address: bob, Balance: 20}, {Address: alice, Balance: 10}},
+	}
+	want := genesisBlock(t, g).Hash()
+	if got := genesisBlock(t, same).Hash(); string(got) != string(want) {
+		t.Fatalf("reordered spec has genesis %x, want %x", got, want)
+	}
+
+	// Authorities and schedule are not in the block itself, but its
+	// previous hash commits to them.
+	for name, other := range map[string]*Genesis{
+		"other authorities": {ChainID: testChainID, Authorities: keys(ws[:2]...), Alloc: g.Alloc},
+		"other period":      {ChainID: testChainID, Authorities: g.Authorities, Period: time.Second, Alloc: g.Alloc},
+	} {
+		if got := genesisBlock(t, other).Hash(); string(got) == string(want) {
+			t.Errorf("spec with %s has the same genesis block", name)
+		}
+	}
+}
+
+func TestGenesisRejects(t *testing.T) {
+	authority := newAuthority(t)
+	tests := []struct {
+		name string
+		spec Genesis
+	}{
+		{"duplicate authority", Genesis{Authorities: keys(authority, newAuthority(t), authority)}},
+		{"duplicate allocation", Genesis{Alloc: []GenesisAlloc{{Address: alice, Balance: 1}, {Address: alice, Balance: 2}}}},
+		{"zero allocation", Genesis{Alloc: []GenesisAlloc{{Address: alice}}}},
+		{"allocation without an address", Genesis{Alloc: []GenesisAlloc{{Balance: 1}}}},
+		{"allocations overflow", Genesis{Alloc: []GenesisAlloc{{Address: alice, Balance: math.MaxUint64}, {Address: bob, Balance: 1}}}},
+		{"negative period", Genesis{Period: -time.Second}},
+		{"timestamp before 1970", Genesis{Timestamp: time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.spec.Block(); !errors.Is(err, ErrInvalidGenesis) {
+				t.Fatalf("Block: got %v, want %v", err, ErrInvalidGenesis)
+			}
+			if _, err := NewBlockchain(NewMemoryStore(), &tt.spec); !errors.Is(err, ErrInvalidGenesis) {
+				t.Fatalf("NewBlockchain: got %v, want %v", err, ErrInvalidGenesis)
+			}
+		})
+	}
+}
+
+func TestLoadGenesisRejects(t *testing.T) {
+	key := hex.EncodeToString(wallet.PublicKeyToFixedBytes(newAuthority(t).PublicKey))
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"duplicate authority", `{"chain_id": "x", "authorities": ["` + key + `", "` + key + `"]}`},
+		{"short authority", `{"chain_id": "x", "authorities": ["` + key[:64] + `"]}`},
+		{"bad address", `{"chain_id": "x", "alloc": {"not-an-address": "1.00"}}`},
+		{"bad period", `{"chain_id": "x", "consensus": {"period": "soon"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "genesis.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadGenesis(path); !errors.Is(err, ErrInvalidGenesis) {
+				t.Fatalf("LoadGenesis: got %v, want %v", err, ErrInvalidGenesis)
+			}
+		})
+	}
+}
+
+func TestNewBlockchainFromGenesis(t *testing.T) {
+	ws := rotation(t, 2)
+	g := &Genesis{
+		ChainID:     testChainID,
+		Authorities: keys(ws...),
+		Alloc:       []GenesisAlloc{{Address: alice, Balance: 10}},
+	}
+	store := NewMemoryStore()
+	bc, err := NewBlockchain(store, g)
+	if err != nil {
+		t.Fatalf("NewBlockchain: %v", err)
+	}
+	if bc.ChainID != testChainID || bc.Consensus == nil || len(bc.Consensus.Authorities) != 2 {
+		t.Fatalf("chain ID %q and consensus %v, want them taken from the spec", bc.ChainID, bc.Consensus)
+	}
+	if got := bc.state.BalanceOf(alice); got != 10 {
+		t.Fatalf("balance of alice = %v, want 10", got)
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	if _, err := NewBlockchain(store, g); err != nil {
+		t.Fatalf("reopening with the same spec: %v", err)
+	}
+	if _, err := NewBlockchain(store, nil); err != nil {
+		t.Fatalf("reopening without a spec: %v", err)
+	}
+	other := *g
+	other.Authorities = keys(ws[0])
+	if _, err := NewBlockchain(store, &other); !errors.Is(err, ErrGenesisMismatch) {
+		t.Fatalf("reopening with other authorities: got %v, want %v", err, ErrGenesisMismatch)
+	}
+}
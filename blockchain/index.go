@@ -0,0 +1,142 @@
+package blockchain
+
+import "bytes"
+
+// TxLocation says where in the canonical chain a transaction is.
+type TxLocation struct {
+	BlockHash []byte
+	Height    uint64
+	// Index is the position of the transaction in its block.
+	Index int
+}
+
+// chainIndex indexes the transactions of the canonical chain by ID and by
+// the addresses that sent them or received funds from them. Blocks are added
+// as they join the chain and removed, newest first, as they leave it in a
+// reorganisation, so the index always matches Blockchain.Chain. Blocks
+// themselves are found by hash and height through the BlockStore.
+type chainIndex struct {
+	txs map[string]TxLocation
+	// addresses lists, for each address, the transactions it sent or
+	// received funds from in chain order.
+	addresses map[string][]TxLocation
+	// beneficiaries maps the ID of every campaign created on the canonical
+	// chain to its beneficiary, who receives the funds it releases.
+	beneficiaries map[string][]byte
+}
+
+func newChainIndex() *chainIndex {
+	return &chainIndex{
+		txs:           make(map[string]TxLocation),
+		addresses:     make(map[string][]TxLocation),
+		beneficiaries: make(map[string][]byte),
+	}
+}
+
+// involved returns the addresses tx is indexed under, each once: the
+// recipient of a mint, and otherwise the sender plus whoever receives funds
+// from tx. That is the recipient of a transfer and the beneficiary of a
+// release; a refund is received by its sender, the donor.
+func (ci *chainIndex) involved(tx *Transactions) []string {
+	if tx.IsMint() {
+		return []string{string(tx.RecipientHash)}
+	}
+	var receiver []byte
+	switch tx.Kind {
+	case TxTransfer:
+		receiver = tx.RecipientHash
+	case TxReleaseFunds:
+		if p, err := tx.DecodePayload(); err == nil {
+			receiver = ci.beneficiaries[string(p.(*ReleaseFundsPayload).CampaignID)]
+		}
+	}
+	if len(receiver) == 0 || bytes.Equal(receiver, tx.SenderHash) {
+		return []string{string(tx.SenderHash)}
+	}
+	return []string{string(tx.SenderHash), string(receiver)}
+}
+
+func (ci *chainIndex) add(b *Block) {
+	hash := b.Hash()
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		loc := TxLocation{BlockHash: hash, Height: b.Header.Height, Index: i}
+		ci.txs[string(tx.ID())] = loc
+		for _, address := range ci.involved(tx) {
+			ci.addresses[address] = append(ci.addresses[address], loc)
+		}
+		if tx.Kind == TxCreateCampaign {
+			if p, err := tx.DecodePayload(); err == nil {
+				ci.beneficiaries[string(tx.ID())] = p.(*CreateCampaignPayload).Beneficiary
+			}
+		}
+	}
+}
+
+// remove undoes add for b, which must be the newest block added.
+func (ci *chainIndex) remove(b *Block) {
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		tx := &b.Transactions[i]
+		delete(ci.txs, string(tx.ID()))
+		if tx.Kind == TxCreateCampaign {
+			delete(ci.beneficiaries, string(tx.ID()))
+		}
+		for _, address := range ci.involved(tx) {
+			locs := ci.addresses[address]
+			if len(locs) > 0 && locs[len(locs)-1].Height == b.Header.Height {
+				locs = locs[:len(locs)-1]
+			}
+			if len(locs) == 0 {
+				delete(ci.addresses, address)
+			} else {
+				ci.addresses[address] = locs
+			}
+		}
+	}
+}
+
+// appendCanonical puts b, with the undo record of applying it, at the end
+// of the canonical chain.
+func (bc *Blockchain) appendCanonical(b *Block, undo stateUndo) {
+	bc.Chain = append(bc.Chain, b)
+	bc.undo = append(bc.undo, undo)
+	bc.index.add(b)
+}
+
+// BlockByHash returns the block with the given hash, whether it is on the
+// canonical chain or a side branch.
+func (bc *Blockchain) BlockByHash(hash []byte) (*Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.store.GetBlock(hash)
+}
+
+// BlockByHeight returns the canonical block at height.
+func (bc *Blockchain) BlockByHeight(height uint64) (*Block, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	if height >= uint64(len(bc.Chain)) {
+		return nil, ErrBlockNotFound
+	}
+	return bc.Chain[height], nil
+}
+
+// Transaction returns the canonical transaction with the given ID and where
+// it is in the chain.
+func (bc *Blockchain) Transaction(id []byte) (*Transactions, TxLocation, bool) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	loc, ok := bc.index.txs[string(id)]
+	if !ok {
+		return nil, TxLocation{}, false
+	}
+	return &bc.Chain[loc.Height].Transactions[loc.Index], loc, true
+}
+
+// AddressTransactions returns where the canonical transactions address sent
+// or received funds from are, oldest first.
+func (bc *Blockchain) AddressTransactions(address []byte) []TxLocation {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return append([]TxLocation(nil), bc.index.addresses[string(address)]...)
+}
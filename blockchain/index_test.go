@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// checkLocations fails the test unless address has exactly the transactions
+// want in the index, in order.
+func checkLocations(t *testing.T, bc *Blockchain, address []byte, want ...*Transactions) {
+	t.Helper()
+	locs := bc.AddressTransactions(address)
+	if len(locs) != len(want) {
+		t.Fatalf("address %x has %d transactions, want %d", address, len(locs), len(want))
+	}
+	for i, loc := range locs {
+		b, err := bc.BlockByHash(loc.BlockHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Header.Height != loc.Height || !bytes.Equal(b.Transactions[loc.Index].ID(), want[i].ID()) {
+			t.Errorf("transaction %d of %x is not the one wanted", i, address)
+		}
+	}
+}
+
+func TestIndexFollowsReorg(t *testing.T) {
+	bc := newFundedChain(t)
+	fork := bc.LastBlock()
+	mint := &fork.Transactions[0]
+	forkState := bc.state.Copy()
+
+	transfer := signedTransfer(t, aliceWallet, 0, bob, 3*amountScale)
+	if err := bc.AddTransaction(transfer); err != nil {
+		t.Fatal(err)
+	}
+	a2, err := bc.CreateBlock(fork.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, loc, ok := bc.Transaction(transfer.ID())
+	if !ok || !bytes.Equal(tx.ID(), transfer.ID()) || loc.Height != 2 || loc.Index != 0 || !bytes.Equal(loc.BlockHash, a2.Hash()) {
+		t.Fatalf("Transaction = %v at %+v, want the transfer at index 0 of block 2", ok, loc)
+	}
+	checkLocations(t, bc, alice, mint, transfer)
+	checkLocations(t, bc, bob, transfer)
+	if b, err := bc.BlockByHeight(2); err != nil || !bytes.Equal(b.Hash(), a2.Hash()) {
+		t.Fatalf("BlockByHeight(2) = %v, want block %x", err, a2.Hash())
+	}
+	if _, err := bc.BlockByHeight(3); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("BlockByHeight(3): got %v, want %v", err, ErrBlockNotFound)
+	}
+
+	// Subscribers are called once the chain is unlocked, so they can query
+	// it and see it reorganised.
+	var head []byte
+	var stillIndexed bool
+	bc.SubscribeReorg(func(ReorgEvent) {
+		head = bc.LastBlock().Hash()
+		_, _, stillIndexed = bc.Transaction(transfer.ID())
+	})
+
+	sideState := forkState.Copy()
+	b2 := blockOn(t, bc, bc.Sealer, fork, sideState, *NewTransaction(testChainID, 0, nil, bob, 5*amountScale))
+	if err := bc.AddBlock(b2); err != nil {
+		t.Fatal(err)
+	}
+	b3 := blockOn(t, bc, bc.Sealer, b2, sideState)
+	if err := bc.AddBlock(b3); err != nil {
+		t.Fatal(err)
+	}
+	checkHead(t, bc, b3)
+	if !bytes.Equal(head, b3.Hash()) || stillIndexed {
+		t.Fatalf("subscriber saw head %x with the transfer indexed %v, want head %x without it", head, stillIndexed, b3.Hash())
+	}
+
+	if _, _, ok := bc.Transaction(transfer.ID()); ok {
+		t.Fatal("orphaned transfer is still indexed")
+	}
+	checkLocations(t, bc, alice, mint)
+	checkLocations(t, bc, bob, &b2.Transactions[0])
+	if b, err := bc.BlockByHash(a2.Hash()); err != nil || !bytes.Equal(b.Hash(), a2.Hash()) {
+		t.Fatalf("BlockByHash of the side block = %v, want block %x", err, a2.Hash())
+	}
+}
+
+func TestAddressTransactionsByKind(t *testing.T) {
+	bc := newFundedChain(t)
+	mint := &bc.LastBlock().Transactions[0]
+	create := typed(t, bobWallet, 0, newCampaignPayload(time.Now().Add(time.Hour), 5*amountScale), 0)
+	donate := typed(t, aliceWallet, 0, &DonatePayload{CampaignID: create.ID()}, 5*amountScale)
+	createBlock(t, bc, create, donate)
+	release := typed(t, bobWallet, 1, &ReleaseFundsPayload{CampaignID: create.ID()}, 0)
+	createBlock(t, bc, release)
+
+	// The beneficiary is indexed by the release that paid it, not by the
+	// campaign naming it.
+	checkLocations(t, bc, bob, create, release)
+	checkLocations(t, bc, alice, mint, donate)
+	checkLocations(t, bc, carol, release)
+	checkLocations(t, bc, nil)
+}
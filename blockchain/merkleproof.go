@@ -0,0 +1,279 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Side says on which side of the path a sibling hash goes when the parent is
+// computed.
+type Side byte
+
+const (
+	// SideLeft means the sibling is the left child: parent = H(sibling || node).
+	SideLeft Side = 0
+	// SideRight means the sibling is the right child: parent = H(node || sibling).
+	SideRight Side = 1
+)
+
+func (s Side) String() string {
+	if s == SideLeft {
+		return "left"
+	}
+	return "right"
+}
+
+// MerkleProof proves that a leaf is part of the tree with a given root. It
+// holds the sibling of every node on the path from the leaf up to the root,
+// bottom first, so anyone who trusts the root, for example from a block
+// header, can check the proof without the rest of the tree.
+type MerkleProof struct {
+	Scheme MerkleScheme
+	// LeafIndex is the position of the leaf, LeafCount the number of
+	// leaves in the tree. Together they fix the shape of the path.
+	LeafIndex uint64
+	LeafCount uint64
+	Siblings  [][]byte
+	Sides     []Side
+}
+
+// VerifyMerkleProof reports whether proof shows that leaf, a transaction
+// hash, is at proof.LeafIndex in the tree with the given root. The sides must
+// agree with the leaf index and the number of siblings with the shape of the
+// tree, so a proof cannot be reused for another position.
+func VerifyMerkleProof(root []byte, leaf []byte, proof *MerkleProof) bool {
+	if proof == nil || !proof.Scheme.valid() || len(proof.Siblings) != len(proof.Sides) {
+		return false
+	}
+	if proof.LeafIndex >= proof.LeafCount {
+		return false
+	}
+
+	scheme := proof.Scheme
+	index, width := proof.LeafIndex, proof.LeafCount
+	hash := scheme.hashLeaf(leaf)
+	next := 0
+	for ; width > 1; index, width = index/2, (width+1)/2 {
+		if scheme == MerkleSchemeTagged && index == width-1 && width%2 == 1 {
+			continue // An odd last node moves up without a sibling.
+		}
+		if next == len(proof.Siblings) {
+			return false
+		}
+		sibling := proof.Siblings[next]
+		if index%2 == 1 {
+			if proof.Sides[next] != SideLeft {
+				return false
+			}
+			hash = scheme.hashNode(sibling, hash)
+		} else {
+			if proof.Sides[next] != SideRight {
+				return false
+			}
+			hash = scheme.hashNode(hash, sibling)
+		}
+		next++
+	}
+	return next == len(proof.Siblings) && bytes.Equal(hash, root)
+}
+
+type merkleProofJSON struct {
+	Scheme    string   `json:"scheme"`
+	LeafIndex uint64   `json:"leaf_index"`
+	LeafCount uint64   `json:"leaf_count"`
+	Siblings  []string `json:"siblings"`
+	Sides     []string `json:"sides"`
+}
+
+// MarshalJSON writes sibling hashes as hex strings and sides as "left" or
+// "right".
+func (p *MerkleProof) MarshalJSON() ([]byte, error) {
+	v := merkleProofJSON{
+		Scheme:    p.Scheme.String(),
+		LeafIndex: p.LeafIndex,
+		LeafCount: p.LeafCount,
+		Siblings:  make([]string, len(p.Siblings)),
+		Sides:     make([]string, len(p.Sides)),
+	}
+	for i, sibling := range p.Siblings {
+		v.Siblings[i] = hex.EncodeToString(sibling)
+	}
+	for i, side := range p.Sides {
+		v.Sides[i] = side.String()
+	}
+	return json.Marshal(v)
+}
+
+func (p *MerkleProof) UnmarshalJSON(data []byte) error {
+	var v merkleProofJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if len(v.Siblings) != len(v.Sides) {
+		return fmt.Errorf("merkle proof has %d siblings but %d sides", len(v.Siblings), len(v.Sides))
+	}
+	proof := MerkleProof{LeafIndex: v.LeafIndex, LeafCount: v.LeafCount}
+	switch v.Scheme {
+	case MerkleSchemeLegacy.String():
+		proof.Scheme = MerkleSchemeLegacy
+	case MerkleSchemeTagged.String():
+		proof.Scheme = MerkleSchemeTagged
+	default:
+		return fmt.Errorf("invalid merkle scheme %q", v.Scheme)
+	}
+	for _, s := range v.Siblings {
+		sibling, err := hex.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("invalid sibling hash: %w", err)
+		}
+		proof.Siblings = append(proof.Siblings, sibling)
+	}
+	for _, s := range v.Sides {
+		switch s {
+		case "left":
+			proof.Sides = append(proof.Sides, SideLeft)
+		case "right":
+			proof.Sides = append(proof.Sides, SideRight)
+		default:
+			return fmt.Errorf("invalid side %q", s)
+		}
+	}
+	*p = proof
+	return nil
+}
+
+// MerkleMultiproof proves that several leaves are part of the same tree at
+// once. Hashes that the verifier can compute from the leaves themselves, such
+// as the parent of two proven siblings, are left out, so a multiproof for
+// leaves that are close together is much smaller than the individual proofs.
+type MerkleMultiproof struct {
+	Scheme    MerkleScheme
+	LeafCount uint64
+	// Indices are the positions of the proven leaves, in increasing order.
+	Indices []uint64
+	// Hashes are the missing siblings, level by level from the leaves up and
+	// left to right within a level.
+	Hashes [][]byte
+}
+
+type merkleEntry struct {
+	index uint64
+	hash  []byte
+}
+
+// walkMultiproof computes the root over the known leaves of a tree with count
+// leaves, level by level. sibling is called for every sibling hash that
+// cannot be computed and must be taken from the proof or the tree; it returns
+// nil if there is none. walkMultiproof returns nil if a sibling is missing.
+func walkMultiproof(scheme MerkleScheme, count uint64, known []merkleEntry, sibling func(level int, index uint64) []byte) []byte {
+	width := count
+	for level := 0; width > 1; level, width = level+1, (width+1)/2 {
+		up := make([]merkleEntry, 0, (len(known)+1)/2)
+		for i := 0; i < len(known); i++ {
+			e := known[i]
+			var left, right []byte
+			switch {
+			case e.index%2 == 1:
+				left, right = sibling(level, e.index-1), e.hash
+			case i+1 < len(known) && known[i+1].index == e.index+1:
+				left, right = e.hash, known[i+1].hash
+				i++
+			case e.index+1 < width:
+				left, right = e.hash, sibling(level, e.index+1)
+			case scheme == MerkleSchemeLegacy:
+				left, right = e.hash, e.hash
+			default:
+				up = append(up, merkleEntry{e.index / 2, e.hash})
+				continue
+			}
+			if left == nil || right == nil {
+				return nil
+			}
+			up = append(up, merkleEntry{e.index / 2, scheme.hashNode(left, right)})
+		}
+		known = up
+	}
+	return known[0].hash
+}
+
+// VerifyMerkleMultiproof reports whether proof shows that leaves, transaction
+// hashes, are at proof.Indices in the tree with the given root.
+func VerifyMerkleMultiproof(root []byte, leaves [][]byte, proof *MerkleMultiproof) bool {
+	if proof == nil || !proof.Scheme.valid() || len(leaves) == 0 || len(leaves) != len(proof.Indices) {
+		return false
+	}
+	known := make([]merkleEntry, len(leaves))
+	for i, index := range proof.Indices {
+		if index >= proof.LeafCount || (i > 0 && index <= proof.Indices[i-1]) {
+			return false
+		}
+		known[i] = merkleEntry{index, proof.Scheme.hashLeaf(leaves[i])}
+	}
+
+	next := 0
+	computed := walkMultiproof(proof.Scheme, proof.LeafCount, known, func(int, uint64) []byte {
+		if next == len(proof.Hashes) {
+			return nil
+		}
+		next++
+		return proof.Hashes[next-1]
+	})
+	return computed != nil && next == len(proof.Hashes) && bytes.Equal(computed, root)
+}
+
+// Size returns the size of the proof's canonical encoding in bytes.
+func (p *MerkleProof) Size() int {
+	return len(EncodeMerkleProof(p))
+}
+
+// Size returns the size of the multiproof's canonical encoding in bytes.
+func (p *MerkleMultiproof) Size() int {
+	return len(EncodeMerkleMultiproof(p))
+}
+
+type merkleMultiproofJSON struct {
+	Scheme    string   `json:"scheme"`
+	LeafCount uint64   `json:"leaf_count"`
+	Indices   []uint64 `json:"indices"`
+	Hashes    []string `json:"hashes"`
+}
+
+func (p *MerkleMultiproof) MarshalJSON() ([]byte, error) {
+	v := merkleMultiproofJSON{
+		Scheme:    p.Scheme.String(),
+		LeafCount: p.LeafCount,
+		Indices:   p.Indices,
+		Hashes:    make([]string, len(p.Hashes)),
+	}
+	for i, hash := range p.Hashes {
+		v.Hashes[i] = hex.EncodeToString(hash)
+	}
+	return json.Marshal(v)
+}
+
+func (p *MerkleMultiproof) UnmarshalJSON(data []byte) error {
+	var v merkleMultiproofJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	proof := MerkleMultiproof{LeafCount: v.LeafCount, Indices: v.Indices}
+	switch v.Scheme {
+	case MerkleSchemeLegacy.String():
+		proof.Scheme = MerkleSchemeLegacy
+	case MerkleSchemeTagged.String():
+		proof.Scheme = MerkleSchemeTagged
+	default:
+		return fmt.Errorf("invalid merkle scheme %q", v.Scheme)
+	}
+	for _, s := range v.Hashes {
+		hash, err := hex.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("invalid hash: %w", err)
+		}
+		proof.Hashes = append(proof.Hashes, hash)
+	}
+	*p = proof
+	return nil
+}
@@ -0,0 +1,182 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// testTransactions returns n distinct unsigned transfers.
+func testTransactions(n int) []Transactions {
+	txs := make([]Transactions, n)
+	for i := range txs {
+		txs[i] = *NewTransaction(testChainID, uint64(i), []byte("alice"), []byte("bob"), 1)
+	}
+	return txs
+}
+
+func TestMerkleProof(t *testing.T) {
+	// Odd sizes exercise the duplicated last node at every level.
+	for n := 1; n <= 9; n++ {
+		b := NewBlock([]byte("previous"), testTransactions(n))
+		root := b.Header.MerkleRoot
+		for i := range b.Transactions {
+			tx := &b.Transactions[i]
+			proof, ok := b.TransactionProof(tx.ID())
+			if !ok {
+				t.Fatalf("%d leaves: no proof of transaction %d", n, i)
+			}
+			if proof.LeafIndex != uint64(i) {
+				t.Fatalf("%d leaves: proof of transaction %d has index %d", n, i, proof.LeafIndex)
+			}
+			if !VerifyMerkleProof(root, tx.Hash(), proof) {
+				t.Fatalf("%d leaves: proof of transaction %d does not verify", n, i)
+			}
+
+			decoded, err := DecodeMerkleProof(EncodeMerkleProof(proof))
+			if err != nil || !reflect.DeepEqual(decoded, proof) {
+				t.Fatalf("%d leaves: encoding round trip of proof %d: %v", n, i, err)
+			}
+			data, err := json.Marshal(proof)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fromJSON MerkleProof
+			if err := json.Unmarshal(data, &fromJSON); err != nil || !reflect.DeepEqual(&fromJSON, proof) {
+				t.Fatalf("%d leaves: JSON round trip of proof %d: %v", n, i, err)
+			}
+		}
+	}
+}
+
+func TestVerifyMerkleProofRejects(t *testing.T) {
+	b := NewBlock([]byte("previous"), testTransactions(5))
+	root := b.Header.MerkleRoot
+	leaf := b.Transactions[2].Hash()
+	valid, ok := b.TransactionProof(b.Transactions[2].ID())
+	if !ok {
+		t.Fatal("no proof")
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *MerkleProof) (root, leaf []byte)
+	}{
+		{"other leaf", func(p *MerkleProof) ([]byte, []byte) { return root, b.Transactions[3].Hash() }},
+		{"other root", func(p *MerkleProof) ([]byte, []byte) { return leaf, leaf }},
+		{"other index", func(p *MerkleProof) ([]byte, []byte) { p.LeafIndex = 3; return root, leaf }},
+		{"index past the tree", func(p *MerkleProof) ([]byte, []byte) { p.LeafIndex += 8; return root, leaf }},
+		{"swapped side", func(p *MerkleProof) ([]byte, []byte) { p.Sides[0] ^= 1; return root, leaf }},
+		{"tampered sibling", func(p *MerkleProof) ([]byte, []byte) {
+			p.Siblings[1] = bytes.Repeat([]byte{0xff}, 32)
+			return root, leaf
+		}},
+		{"missing sibling", func(p *MerkleProof) ([]byte, []byte) {
+			p.Siblings, p.Sides = p.Siblings[:len(p.Siblings)-1], p.Sides[:len(p.Sides)-1]
+			return root, leaf
+		}},
+		{"more sides than siblings", func(p *MerkleProof) ([]byte, []byte) {
+			p.Sides = append(p.Sides, SideRight)
+			return root, leaf
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &MerkleProof{
+				LeafIndex: valid.LeafIndex,
+				Siblings:  append([][]byte(nil), valid.Siblings...),
+				Sides:     append([]Side(nil), valid.Sides...),
+			}
+			root, leaf := tt.modify(p)
+			if VerifyMerkleProof(root, leaf, p) {
+				t.Fatal("proof verifies")
+			}
+		})
+	}
+}
+
+func TestMerkleMultiproof(t *testing.T) {
+	const leaves = 10_000
+	hashes := benchmarkHashes(leaves)
+	consecutive := make([]int, 32)
+	spread := make([]int, 32)
+	for i := range consecutive {
+		consecutive[i] = 5000 + i
+		spread[i] = i * leaves / 32
+	}
+
+	for _, scheme := range []MerkleScheme{MerkleSchemeLegacy, MerkleSchemeTagged} {
+		tree := NewMerkleTreeFromHashes(hashes, scheme)
+		root := tree.CalculateMerkleRoot()
+		for _, c := range []struct {
+			name    string
+			indices []int
+		}{{"consecutive", consecutive}, {"spread", spread}, {"single", []int{leaves - 1}}} {
+			t.Run(scheme.String()+"/"+c.name, func(t *testing.T) {
+				proof, ok := tree.MultiproofAt(c.indices)
+				if !ok {
+					t.Fatal("MultiproofAt failed")
+				}
+				proven := make([][]byte, len(c.indices))
+				singles := 0
+				for i, index := range c.indices {
+					proven[i] = hashes[index]
+					single, ok := tree.ProofAt(index)
+					if !ok || !VerifyMerkleProof(root, hashes[index], single) {
+						t.Fatalf("proof of leaf %d does not verify", index)
+					}
+					singles += single.Size()
+				}
+				if !VerifyMerkleMultiproof(root, proven, proof) {
+					t.Fatal("multiproof does not verify")
+				}
+				decoded, err := DecodeMerkleMultiproof(EncodeMerkleMultiproof(proof))
+				if err != nil || !reflect.DeepEqual(decoded, proof) {
+					t.Fatalf("encoding round trip: %v", err)
+				}
+				if len(c.indices) > 1 && proof.Size() >= singles {
+					t.Errorf("multiproof is %d bytes, single proofs %d", proof.Size(), singles)
+				}
+				t.Logf("multiproof %d bytes, single proofs %d bytes", proof.Size(), singles)
+
+				for _, tamper := range []struct {
+					name   string
+					modify func(p *MerkleMultiproof, leaves [][]byte) ([]byte, [][]byte)
+				}{
+					{"leaf", func(p *MerkleMultiproof, leaves [][]byte) ([]byte, [][]byte) {
+						leaves[0] = hashes[(c.indices[0]+1)%len(hashes)]
+						return root, leaves
+					}},
+					{"index", func(p *MerkleMultiproof, leaves [][]byte) ([]byte, [][]byte) {
+						p.Indices[len(p.Indices)-1]--
+						return root, leaves
+					}},
+					{"hash", func(p *MerkleMultiproof, leaves [][]byte) ([]byte, [][]byte) {
+						p.Hashes[0] = bytes.Repeat([]byte{0xff}, 32)
+						return root, leaves
+					}},
+					{"missing hash", func(p *MerkleMultiproof, leaves [][]byte) ([]byte, [][]byte) {
+						p.Hashes = p.Hashes[:len(p.Hashes)-1]
+						return root, leaves
+					}},
+					{"extra hash", func(p *MerkleMultiproof, leaves [][]byte) ([]byte, [][]byte) {
+						p.Hashes = append(p.Hashes, root)
+						return root, leaves
+					}},
+					{"root", func(p *MerkleMultiproof, leaves [][]byte) ([]byte, [][]byte) {
+						return hashes[0], leaves
+					}},
+				} {
+					p := *proof
+					p.Indices = append([]uint64(nil), proof.Indices...)
+					p.Hashes = append([][]byte(nil), proof.Hashes...)
+					r, l := tamper.modify(&p, append([][]byte(nil), proven...))
+					if VerifyMerkleMultiproof(r, l, &p) {
+						t.Errorf("multiproof with tampered %s verifies", tamper.name)
+					}
+				}
+			})
+		}
+	}
+}
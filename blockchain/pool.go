@@ -0,0 +1,96 @@
+package blockchain
+
+import "github.com/Roshan310/DaanVeer/mempool"
+
+// MaxBlockSize is the maximum total encoded size of the transactions
+// CreateBlock puts into one block.
+const MaxBlockSize = 1 << 20
+
+// poolTx is a transaction as seen by the mempool. The ID and size are worked
+// out once on admission since the pool asks for them repeatedly.
+type poolTx struct {
+	tx   *Transactions
+	id   string
+	size int
+}
+
+func newPoolTx(tx *Transactions) *poolTx {
+	return &poolTx{tx: tx, id: string(tx.ID()), size: len(EncodeTransaction(tx))}
+}
+
+func (p *poolTx) ID() string     { return p.id }
+func (p *poolTx) Sender() string { return string(p.tx.SenderHash) }
+
+// Nonce is the sender nonce of the transaction. Mints have no sender nonce and
+// are ordered by creation time instead.
+func (p *poolTx) Nonce() uint64 {
+	if p.tx.IsMint() {
+		return p.tx.Timestamp
+	}
+	return p.tx.Nonce
+}
+
+func (p *poolTx) Cost() uint64 { return uint64(p.tx.Value) }
+func (p *poolTx) Size() int    { return p.size }
+
+// Verify checks the transaction against the rules of its kind and checks
+// its signature.
+func (p *poolTx) Verify() error {
+	if err := p.tx.CheckPayload(); err != nil {
+		return err
+	}
+	return p.tx.Verify()
+}
+
+// poolState lets the mempool check balances at the current head. The pool
+// only calls it from methods of the chain, which hold the chain's lock.
+type poolState struct {
+	bc *Blockchain
+}
+
+func (s poolState) Balance(sender string) uint64 {
+	return uint64(s.bc.state.BalanceOf([]byte(sender)))
+}
+
+func (s poolState) Nonce(sender string) uint64 {
+	return s.bc.state.NonceOf([]byte(sender))
+}
+
+// SetPoolConfig replaces the pool with an empty one limited by config.
+func (bc *Blockchain) SetPoolConfig(config mempool.Config) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.Pool = mempool.New(config, poolState{bc})
+}
+
+// NextNonce returns the nonce the next transaction of address must carry,
+// counting the transactions it already has in the pool.
+func (bc *Blockchain) NextNonce(address []byte) uint64 {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.Pool.NextNonce(string(address))
+}
+
+// PendingTransactions returns the pooled transactions in the order they
+// would be put into blocks.
+func (bc *Blockchain) PendingTransactions() []*Transactions {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	pending := bc.Pool.Pending()
+	txs := make([]*Transactions, len(pending))
+	for i, p := range pending {
+		txs[i] = p.(*poolTx).tx
+	}
+	return txs
+}
+
+// removeIncluded drops the transactions of b from the pool, followed by any
+// pooled transaction the new head state can no longer pay for.
+func (bc *Blockchain) removeIncluded(b *Block) {
+	ids := make([]string, len(b.Transactions))
+	for i := range b.Transactions {
+		ids[i] = string(b.Transactions[i].ID())
+	}
+	bc.Pool.Remove(ids...)
+	bc.Pool.Revalidate()
+}
@@ -0,0 +1,200 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// ReceiptStatus says whether a transaction took effect.
+type ReceiptStatus string
+
+const (
+	ReceiptSuccess ReceiptStatus = "success"
+	// ReceiptFailed marks a transaction that was included in a block but
+	// could not be carried out. It used up the sender's nonce and changed
+	// nothing else.
+	ReceiptFailed ReceiptStatus = "failed"
+)
+
+// Receipt records the outcome of a transaction in a block.
+type Receipt struct {
+	TxID   []byte
+	Status ReceiptStatus
+	// Fee is what the sender paid for the transaction. The chain charges no
+	// fees yet, so it is always zero.
+	Fee    Amount
+	Events []Event
+	// Error is why the transaction failed, empty if it succeeded.
+	Error string
+
+	// BlockHash, Height and Index say where the transaction is. They are
+	// filled in when the receipt is read and are not part of its hash.
+	BlockHash []byte
+	Height    uint64
+	Index     int
+}
+
+// Event is something a transaction did, such as moving funds, described by
+// a type and a list of attributes.
+type Event struct {
+	Type       string
+	Attributes []EventAttribute
+}
+
+type EventAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Hash returns the SHA-256 of the canonical encoding of the receipt, which is
+// the leaf the receipts root commits to.
+func (r *Receipt) Hash() []byte {
+	hash := sha256.Sum256(EncodeReceipt(r))
+	return hash[:]
+}
+
+// ReceiptsTree builds the Merkle tree over the hashes of receipts, in order.
+// Receipts trees always use MerkleSchemeTagged.
+func ReceiptsTree(receipts []*Receipt) *MerkleTree {
+	hashes := make([][]byte, len(receipts))
+	for i, r := range receipts {
+		hashes[i] = r.Hash()
+	}
+	return NewMerkleTreeFromHashes(hashes, MerkleSchemeTagged)
+}
+
+// ReceiptsRoot returns the root of ReceiptsTree(receipts), which every block
+// carries as its ReceiptsRoot.
+func ReceiptsRoot(receipts []*Receipt) []byte {
+	return ReceiptsTree(receipts).CalculateMerkleRoot()
+}
+
+// transferEvents returns the events of a transaction that succeeded: a mint
+// or a transfer, with addresses in wallet form.
+func transferEvents(tx *Transactions) []Event {
+	to := EventAttribute{"to", wallet.AddressFromPubKeyHash(tx.RecipientHash)}
+	value := EventAttribute{"value", tx.Value.String()}
+	if tx.IsMint() {
+		return []Event{{Type: "mint", Attributes: []EventAttribute{to, value}}}
+	}
+	from := EventAttribute{"from", wallet.AddressFromPubKeyHash(tx.SenderHash)}
+	return []Event{{Type: "transfer", Attributes: []EventAttribute{from, to, value}}}
+}
+
+// executionFailures are the errors that mean a transaction could not be
+// carried out, as opposed to being invalid. Only the first kind can be
+// included in a block with a failed receipt. A sender who cannot pay is the
+// second kind: with no fees, a failed receipt for an overspend would let
+// anyone fill blocks for free.
+var executionFailures = []error{
+	ErrAmountOverflow,
+	ErrUnknownCampaign,
+	ErrCampaignDeadline,
+	ErrCampaignPaidOut,
+	ErrNotCampaignOwner,
+	ErrGoalNotReached,
+	ErrMilestoneOrder,
+	ErrNotRefundable,
+	ErrNothingToRefund,
+}
+
+func executionFailure(err error) bool {
+	for _, failure := range executionFailures {
+		if errors.Is(err, failure) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExecuteTransaction carries out tx, which is in the block with header h,
+// and returns its receipt. A transaction that is valid but cannot be carried
+// out uses up the sender's nonce and gets a failed receipt instead of an
+// error.
+func (s *State) ExecuteTransaction(tx *Transactions, h *BlockHeader) (*Receipt, error) {
+	r := &Receipt{TxID: tx.ID(), Status: ReceiptSuccess}
+	events, err := s.applyTransaction(tx, h)
+	switch {
+	case err == nil:
+		r.Events = events
+	case executionFailure(err):
+		if !tx.IsMint() {
+			s.nonces[string(tx.SenderHash)]++
+		}
+		r.Status = ReceiptFailed
+		r.Error = err.Error()
+	default:
+		return nil, err
+	}
+	return r, nil
+}
+
+// ExecuteBlock applies every transaction of b in order and returns their
+// receipts. A transaction that cannot be carried out does not make the block
+// invalid but gets a failed receipt. If a transaction is invalid the state is
+// left untouched and a *ValidationError naming it is returned.
+func (s *State) ExecuteBlock(b *Block) ([]*Receipt, error) {
+	next := s.Copy()
+	receipts := make([]*Receipt, len(b.Transactions))
+	for i := range b.Transactions {
+		r, err := next.ExecuteTransaction(&b.Transactions[i], &b.Header)
+		if err != nil {
+			return nil, invalid(b, i, err)
+		}
+		r.Height, r.Index = b.Header.Height, i
+		receipts[i] = r
+	}
+	s.balances = next.balances
+	s.nonces = next.nonces
+	s.campaigns = next.campaigns
+	return receipts, nil
+}
+
+// located fills in where the receipts of b are.
+func located(b *Block, receipts []*Receipt) []*Receipt {
+	hash := b.Hash()
+	for i, r := range receipts {
+		r.BlockHash, r.Height, r.Index = hash, b.Header.Height, i
+	}
+	return receipts
+}
+
+// Receipts returns the receipts of the block with the given hash.
+func (bc *Blockchain) Receipts(hash []byte) ([]*Receipt, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.receipts(hash)
+}
+
+// receipts is Receipts for callers holding the lock.
+func (bc *Blockchain) receipts(hash []byte) ([]*Receipt, error) {
+	b, err := bc.store.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := bc.store.GetReceipts(hash)
+	if err != nil {
+		return nil, err
+	}
+	return located(b, receipts), nil
+}
+
+// Receipt returns the receipt of the canonical transaction with the given ID.
+func (bc *Blockchain) Receipt(id []byte) (*Receipt, bool, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	loc, ok := bc.index.txs[string(id)]
+	if !ok {
+		return nil, false, nil
+	}
+	receipts, err := bc.receipts(loc.BlockHash)
+	if err != nil {
+		return nil, false, err
+	}
+	if loc.Index >= len(receipts) {
+		return nil, false, ErrReceiptsNotFound
+	}
+	return receipts[loc.Index], true, nil
+}
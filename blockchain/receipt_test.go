@@ -0,0 +1,166 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// goldenReceipt is the receipt of the golden vectors in docs/encoding.md.
+func goldenReceipt() *Receipt {
+	return &Receipt{
+		TxID:   []byte{0xaa, 0xbb},
+		Status: ReceiptSuccess,
+		Events: []Event{{Type: "transfer", Attributes: []EventAttribute{
+			{"from", "alice"}, {"to", "bob"}, {"value", "12.50"},
+		}}},
+	}
+}
+
+const (
+	goldenReceiptEncoding = "011000000002aabb0100000000000000000000000000000001000000087472616e73666572000000030000000466726f6d00000005616c69636500000002746f00000003626f620000000576616c75650000000531322e3530"
+	goldenReceiptHash     = "12a3899c21d7021de23d34319683896c6226433a8ad30d0ca99c242e04d9c49c"
+	goldenReceiptsRoot    = "0a3b431daaf65f6cb26bc92bb3932a9e638bdb18aa2d90ac04d5cf94f1dbc51d"
+)
+
+func TestReceiptGoldenVector(t *testing.T) {
+	r := goldenReceipt()
+	if got := hex.EncodeToString(EncodeReceipt(r)); got != goldenReceiptEncoding {
+		t.Errorf("encoding = %s, want %s", got, goldenReceiptEncoding)
+	}
+	if got := hex.EncodeToString(r.Hash()); got != goldenReceiptHash {
+		t.Errorf("hash = %s, want %s", got, goldenReceiptHash)
+	}
+	if got := hex.EncodeToString(ReceiptsRoot([]*Receipt{r})); got != goldenReceiptsRoot {
+		t.Errorf("receipts root = %s, want %s", got, goldenReceiptsRoot)
+	}
+
+	// Where the receipt is does not change its hash.
+	r.BlockHash, r.Height, r.Index = []byte{1}, 2, 3
+	if got := hex.EncodeToString(r.Hash()); got != goldenReceiptHash {
+		t.Errorf("hash of a located receipt = %s, want %s", got, goldenReceiptHash)
+	}
+}
+
+func TestReceiptsRoundTrip(t *testing.T) {
+	receipts := []*Receipt{
+		goldenReceipt(),
+		{TxID: []byte{0xcc}, Status: ReceiptFailed, Error: "amount overflow"},
+	}
+	decoded, err := DecodeReceipts(EncodeReceipts(receipts))
+	if err != nil {
+		t.Fatalf("DecodeReceipts: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, receipts) {
+		t.Fatalf("DecodeReceipts = %+v, want %+v", decoded, receipts)
+	}
+	if _, err := DecodeReceipts(EncodeReceipt(receipts[0])); !errors.Is(err, ErrMalformedEncoding) {
+		t.Fatalf("DecodeReceipts of a single receipt: got %v, want %v", err, ErrMalformedEncoding)
+	}
+}
+
+func TestExecuteTransaction(t *testing.T) {
+	state := NewState()
+	state.balances[string(alice)] = 10 * amountScale
+	state.balances[string(bob)] = math.MaxUint64 - 1
+	h := &BlockHeader{Timestamp: uint64(time.Now().UnixNano())}
+
+	// An overspend is invalid: it fails without using up the nonce.
+	if _, err := state.ExecuteTransaction(signedTransfer(t, aliceWallet, 0, bob, 11*amountScale), h); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("overspend: got %v, want %v", err, ErrInsufficientFunds)
+	}
+	if state.NonceOf(alice) != 0 {
+		t.Fatalf("overspend used up nonce %d", state.NonceOf(alice))
+	}
+
+	// A credit bob cannot hold is carried out as a failed receipt that only
+	// uses up the nonce.
+	overflow := signedTransfer(t, aliceWallet, 0, bob, 2)
+	r, err := state.ExecuteTransaction(overflow, h)
+	if err != nil {
+		t.Fatalf("overflow: %v", err)
+	}
+	if r.Status != ReceiptFailed || r.Error == "" || len(r.Events) != 0 || !bytes.Equal(r.TxID, overflow.ID()) {
+		t.Fatalf("overflow receipt = %+v, want a failed one without events", r)
+	}
+	if state.NonceOf(alice) != 1 || state.BalanceOf(alice) != 10*amountScale || state.BalanceOf(bob) != math.MaxUint64-1 {
+		t.Fatalf("overflow left alice at nonce %d with %s and bob with %s", state.NonceOf(alice), state.BalanceOf(alice), state.BalanceOf(bob))
+	}
+
+	r, err = state.ExecuteTransaction(signedTransfer(t, aliceWallet, 1, alice, 1), h)
+	if err != nil || r.Status != ReceiptSuccess || len(r.Events) != 1 || r.Events[0].Type != "transfer" {
+		t.Fatalf("transfer: receipt %+v, %v", r, err)
+	}
+}
+
+func TestCreateBlockRecordsReceipts(t *testing.T) {
+	bc := newFundedChain(t)
+	if err := bc.Mint(bob, math.MaxUint64-amountScale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.CreateBlock(bc.LastBlock().Hash()); err != nil {
+		t.Fatal(err)
+	}
+
+	transfer := signedTransfer(t, aliceWallet, 0, bob, amountScale)
+	overflow := signedTransfer(t, aliceWallet, 1, bob, 1)
+	for _, tx := range []*Transactions{transfer, overflow} {
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := bc.CreateBlock(bc.LastBlock().Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Transactions) != 2 {
+		t.Fatalf("block holds %d transactions, want the transfer and the failed one", len(b.Transactions))
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	receipts, err := bc.Receipts(b.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ReceiptsRoot(receipts), b.Header.ReceiptsRoot) {
+		t.Fatalf("stored receipts do not match the receipts root")
+	}
+	for i, tx := range []*Transactions{transfer, overflow} {
+		r, ok, err := bc.Receipt(tx.ID())
+		if err != nil || !ok {
+			t.Fatalf("Receipt(%d) = %v, %v", i, ok, err)
+		}
+		if !bytes.Equal(r.BlockHash, b.Hash()) || r.Height != b.Header.Height || r.Index != i {
+			t.Errorf("receipt %d is at block %x height %d index %d", i, r.BlockHash, r.Height, r.Index)
+		}
+		proof, _ := ReceiptsTree(receipts).ProofAt(i)
+		if !VerifyMerkleProof(b.Header.ReceiptsRoot, r.Hash(), proof) {
+			t.Errorf("receipt %d does not verify against the header", i)
+		}
+	}
+	if r, _, _ := bc.Receipt(transfer.ID()); r.Status != ReceiptSuccess {
+		t.Errorf("transfer receipt = %+v, want success", r)
+	}
+	if r, _, _ := bc.Receipt(overflow.ID()); r.Status != ReceiptFailed {
+		t.Errorf("overflow receipt = %+v, want failed", r)
+	}
+	if got := bc.BalanceOf(bob); got != math.MaxUint64 {
+		t.Errorf("bob has %s, want the most an account can hold", got)
+	}
+}
+
+func TestAddBlockRejectsWrongReceiptsRoot(t *testing.T) {
+	bc := newFundedChain(t)
+	b := childBlock(bc, *signedTransfer(t, aliceWallet, 0, bob, amountScale))
+	b.Header.ReceiptsRoot = ReceiptsRoot(nil)
+	seal(t, bc, bc.Sealer, b)
+	if err := bc.AddBlock(b); !errors.Is(err, ErrBadReceiptsRoot) {
+		t.Fatalf("AddBlock: got %v, want %v", err, ErrBadReceiptsRoot)
+	}
+}
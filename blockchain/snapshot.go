@@ -0,0 +1,240 @@
+package blockchain
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+var ErrInvalidVote = errors.New("invalid authority vote")
+
+// Vote is an authority's proposal, carried in a block header or an
+// authority-vote transaction, to add a new authority or to revoke an existing
+// one.
+type Vote struct {
+	Voter     string
+	Candidate string
+	// Key is the candidate's public key, needed when it is being added.
+	Key       *ecdsa.PublicKey
+	Authorize bool
+}
+
+// Snapshot is the state of authority governance after a given block: who
+// the authorities are, which votes are still open and who sealed the most
+// recent blocks. The snapshot at any height is rebuilt by applying the
+// blocks of the chain, in order, to the genesis snapshot, so every change to
+// the authority set can be traced back to the blocks that voted for it.
+type Snapshot struct {
+	Height uint64
+	Hash   []byte
+	// Authorities are the current authorities in rotation order.
+	Authorities []Authority
+	// Votes are the open votes, at most one per voter and candidate.
+	Votes []Vote
+	// Recents maps the heights of recent blocks to their proposers.
+	Recents map[uint64]string
+}
+
+func newSnapshot(height uint64, hash []byte, authorities []Authority) *Snapshot {
+	snap := &Snapshot{
+		Height:      height,
+		Hash:        hash,
+		Authorities: append([]Authority(nil), authorities...),
+		Recents:     make(map[uint64]string),
+	}
+	snap.sortAuthorities()
+	return snap
+}
+
+func (snap *Snapshot) sortAuthorities() {
+	sort.Slice(snap.Authorities, func(i, j int) bool {
+		return snap.Authorities[i].Address < snap.Authorities[j].Address
+	})
+}
+
+func (snap *Snapshot) copy() *Snapshot {
+	c := newSnapshot(snap.Height, snap.Hash, snap.Authorities)
+	c.Votes = append([]Vote(nil), snap.Votes...)
+	for height, address := range snap.Recents {
+		c.Recents[height] = address
+	}
+	return c
+}
+
+// authority returns the authority with the given address.
+func (snap *Snapshot) authority(address string) (*Authority, bool) {
+	for i := range snap.Authorities {
+		if snap.Authorities[i].Address == address {
+			return &snap.Authorities[i], true
+		}
+	}
+	return nil, false
+}
+
+func (snap *Snapshot) IsAuthorized(address string) bool {
+	_, ok := snap.authority(address)
+	return ok
+}
+
+// Proposer returns the address of the authority that is in turn to seal the
+// block at height.
+func (snap *Snapshot) Proposer(height uint64) string {
+	if len(snap.Authorities) == 0 {
+		return ""
+	}
+	return snap.Authorities[height%uint64(len(snap.Authorities))].Address
+}
+
+// IsInTurn reports whether address is the in-turn proposer at height.
+func (snap *Snapshot) IsInTurn(address string, height uint64) bool {
+	return snap.Proposer(height) == address
+}
+
+// SignerLimit is the number of preceding blocks an authority must not have
+// sealed in order to seal the next one.
+func (snap *Snapshot) SignerLimit() int {
+	return len(snap.Authorities) / 2
+}
+
+// Tally returns how many authorities currently vote for candidate in the
+// given direction.
+func (snap *Snapshot) Tally(candidate string, authorize bool) int {
+	count := 0
+	for _, vote := range snap.Votes {
+		if vote.Candidate == candidate && vote.Authorize == authorize {
+			count++
+		}
+	}
+	return count
+}
+
+// validVote reports whether a vote would change anything: adding someone who
+// is not yet an authority or revoking someone who is.
+func (snap *Snapshot) validVote(candidate string, authorize bool) bool {
+	return snap.IsAuthorized(candidate) != authorize
+}
+
+// Apply returns the snapshot after header, which must be the child of the
+// block the snapshot was taken at, counting only the vote in the header. The
+// receiver is not modified.
+func (snap *Snapshot) Apply(header *BlockHeader) (*Snapshot, error) {
+	if header.Height != snap.Height+1 {
+		return nil, fmt.Errorf("snapshot at %d cannot apply block %d", snap.Height, header.Height)
+	}
+	next := snap.copy()
+	next.Height = header.Height
+	next.Hash = header.Hash()
+
+	if limit := uint64(next.SignerLimit()); header.Height >= limit {
+		for height := range next.Recents {
+			if height+limit <= header.Height {
+				delete(next.Recents, height)
+			}
+		}
+	}
+	next.Recents[header.Height] = header.Proposer
+
+	if len(header.VoteCandidate) == 0 {
+		return next, nil
+	}
+	key, err := wallet.BytesToPublicKey(header.VoteCandidate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidVote, err)
+	}
+	vote := Vote{
+		Voter:     header.Proposer,
+		Candidate: wallet.GenerateAddress(key),
+		Key:       key,
+		Authorize: header.VoteAuthorize,
+	}
+	if !next.validVote(vote.Candidate, vote.Authorize) {
+		return nil, fmt.Errorf("%w: %s already has that status", ErrInvalidVote, vote.Candidate)
+	}
+	next.cast(vote)
+	return next, nil
+}
+
+// ApplyBlock returns the snapshot after b: the header is applied as by Apply
+// and then the votes of b's authority-vote transactions are counted, in
+// order. A transaction vote that is not from an authority or would not
+// change anything makes the block invalid. The receiver is not modified.
+func (snap *Snapshot) ApplyBlock(b *Block) (*Snapshot, error) {
+	next, err := snap.Apply(&b.Header)
+	if err != nil {
+		return nil, err
+	}
+	for i := range b.Transactions {
+		if err := next.castTx(&b.Transactions[i]); err != nil {
+			return nil, invalid(b, i, fmt.Errorf("%w: %v", ErrBadVote, err))
+		}
+	}
+	return next, nil
+}
+
+// castTx counts the vote of tx if it is an authority-vote transaction.
+func (snap *Snapshot) castTx(tx *Transactions) error {
+	if tx.Kind != TxAuthorityVote {
+		return nil
+	}
+	payload, err := tx.DecodePayload()
+	if err != nil {
+		return err
+	}
+	p := payload.(*AuthorityVotePayload)
+	voter := wallet.AddressFromPubKeyHash(tx.SenderHash)
+	if !snap.IsAuthorized(voter) {
+		return fmt.Errorf("%w: %s is not an authority", ErrInvalidVote, voter)
+	}
+	key, err := wallet.BytesToPublicKey(p.Candidate)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVote, err)
+	}
+	vote := Vote{Voter: voter, Candidate: wallet.GenerateAddress(key), Key: key, Authorize: p.Authorize}
+	if !snap.validVote(vote.Candidate, vote.Authorize) {
+		return fmt.Errorf("%w: %s already has that status", ErrInvalidVote, vote.Candidate)
+	}
+	snap.cast(vote)
+	return nil
+}
+
+// cast records a vote, replacing any earlier vote of the same voter on the
+// same candidate, and applies the change once a majority agrees.
+func (snap *Snapshot) cast(vote Vote) {
+	votes := snap.Votes[:0]
+	for _, v := range snap.Votes {
+		if v.Voter != vote.Voter || v.Candidate != vote.Candidate {
+			votes = append(votes, v)
+		}
+	}
+	snap.Votes = append(votes, vote)
+
+	if snap.Tally(vote.Candidate, vote.Authorize) <= len(snap.Authorities)/2 {
+		return
+	}
+
+	if vote.Authorize {
+		snap.Authorities = append(snap.Authorities, Authority{Address: vote.Candidate, PublicKey: vote.Key})
+		snap.sortAuthorities()
+	} else {
+		authorities := snap.Authorities[:0]
+		for _, authority := range snap.Authorities {
+			if authority.Address != vote.Candidate {
+				authorities = append(authorities, authority)
+			}
+		}
+		snap.Authorities = authorities
+	}
+
+	// The question is settled, and a revoked authority no longer has a say
+	// in the open ones.
+	votes = snap.Votes[:0]
+	for _, v := range snap.Votes {
+		if v.Candidate != vote.Candidate && (vote.Authorize || v.Voter != vote.Candidate) {
+			votes = append(votes, v)
+		}
+	}
+	snap.Votes = votes
+}
@@ -0,0 +1,201 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrInvalidValue      = errors.New("transaction value must be positive")
+	ErrMissingSender     = errors.New("transaction has no sender")
+	ErrMissingRecipient  = errors.New("transfer has no recipient")
+	ErrBadNonce          = errors.New("transaction nonce is not the sender's next nonce")
+)
+
+// State is the balance and nonce of every account, derived by applying the
+// blocks of the chain in order. Transactions without a sender are mints: they
+// record funds entering the platform (for example a fiat donation received by
+// an authority). They are only valid in blocks signed by an authority (see
+// ErrUnsealedMint), which makes that authority answerable for them.
+type State struct {
+	balances map[string]Amount
+	// nonces counts the transactions each sender has made, which is the
+	// nonce their next transaction must carry.
+	nonces map[string]uint64
+	// campaigns holds every campaign by ID. A campaign is replaced rather
+	// than changed when a transaction touches it, so copies of the state
+	// can share them.
+	campaigns map[string]*Campaign
+}
+
+func NewState() *State {
+	return &State{balances: make(map[string]Amount), nonces: make(map[string]uint64), campaigns: make(map[string]*Campaign)}
+}
+
+// Copy returns an independent copy of the state.
+func (s *State) Copy() *State {
+	c := NewState()
+	for address, balance := range s.balances {
+		c.balances[address] = balance
+	}
+	for address, nonce := range s.nonces {
+		c.nonces[address] = nonce
+	}
+	for id, campaign := range s.campaigns {
+		c.campaigns[id] = campaign
+	}
+	return c
+}
+
+// BalanceOf returns the balance of an address. Unknown addresses have a
+// balance of zero.
+func (s *State) BalanceOf(address []byte) Amount {
+	return s.balances[string(address)]
+}
+
+// Account is the state of one address as committed to by the state root.
+type Account struct {
+	Balance Amount
+	Nonce   uint64
+}
+
+// AccountKey returns the key an address's Account is stored under in the
+// state tree.
+func AccountKey(address []byte) []byte {
+	return append([]byte("account:"), address...)
+}
+
+// Account returns the state of address.
+func (s *State) Account(address []byte) Account {
+	return Account{Balance: s.balances[string(address)], Nonce: s.nonces[string(address)]}
+}
+
+// Tree builds the state tree over every account, campaign and campaign
+// contribution. Accounts with neither a balance nor a nonce are left out, as
+// if they had never been touched.
+func (s *State) Tree() *StateTree {
+	tree := NewStateTree()
+	for address := range s.balances {
+		s.addAccount(tree, []byte(address))
+	}
+	for address := range s.nonces {
+		s.addAccount(tree, []byte(address))
+	}
+	s.addCampaigns(tree)
+	return tree
+}
+
+func (s *State) addAccount(tree *StateTree, address []byte) {
+	if account := s.Account(address); account != (Account{}) {
+		tree.Set(AccountKey(address), EncodeAccount(&account))
+	}
+}
+
+// Root returns the root of the state tree, which every block carries as its
+// StateRoot.
+func (s *State) Root() []byte {
+	return s.Tree().Root()
+}
+
+// ProveAccount returns the account of address together with a proof of it
+// against Root. For an untouched account the proof shows it is absent.
+func (s *State) ProveAccount(address []byte) (Account, *StateProof) {
+	return s.Account(address), s.Tree().Prove(AccountKey(address))
+}
+
+// VerifyAccountProof reports whether proof shows that address has account
+// in the state with the given root.
+func VerifyAccountProof(root []byte, address []byte, account Account, proof *StateProof) bool {
+	var value []byte
+	if account != (Account{}) {
+		value = EncodeAccount(&account)
+	}
+	return VerifyStateProof(root, AccountKey(address), value, proof)
+}
+
+// NonceOf returns the nonce the next transaction of address must carry.
+func (s *State) NonceOf(address []byte) uint64 {
+	return s.nonces[string(address)]
+}
+
+// ApplyTransaction applies a transfer: it moves the value of tx from sender
+// to recipient and, unless tx is a mint, uses up the sender's nonce. The
+// state is left untouched if the transaction cannot be applied. Transactions
+// of other kinds depend on the block they are in and are applied with
+// ExecuteTransaction.
+func (s *State) ApplyTransaction(tx *Transactions) error {
+	if tx.Kind != TxTransfer {
+		return fmt.Errorf("%w: %s needs its block, see ExecuteTransaction", ErrUnknownTxKind, tx.Kind)
+	}
+	_, err := s.applyTransaction(tx, nil)
+	return err
+}
+
+// stateUndo holds the accounts and campaigns a block changed as they were
+// before it, which is all it takes to step the state back over the block.
+type stateUndo struct {
+	accounts map[string]Account
+	// campaigns maps the campaigns the block created to nil.
+	campaigns map[string]*Campaign
+}
+
+// undoTo records what differs between s and next, a state derived from s by
+// applying a block, as it is in s. Campaigns are replaced rather than
+// changed, so a campaign differs exactly when its pointer does.
+func (s *State) undoTo(next *State) stateUndo {
+	undo := stateUndo{accounts: make(map[string]Account), campaigns: make(map[string]*Campaign)}
+	for _, accounts := range []*State{s, next} {
+		for address := range accounts.balances {
+			s.recordAccount(undo, next, address)
+		}
+		for address := range accounts.nonces {
+			s.recordAccount(undo, next, address)
+		}
+	}
+	for id, c := range next.campaigns {
+		if s.campaigns[id] != c {
+			undo.campaigns[id] = s.campaigns[id]
+		}
+	}
+	return undo
+}
+
+// recordAccount records address in undo if its account differs in next.
+func (s *State) recordAccount(undo stateUndo, next *State, address string) {
+	if account := s.Account([]byte(address)); account != next.Account([]byte(address)) {
+		undo.accounts[address] = account
+	}
+}
+
+// revert undoes the block undo was recorded for, which must be the last
+// block applied to s.
+func (s *State) revert(undo stateUndo) {
+	for address, account := range undo.accounts {
+		if account.Balance == 0 {
+			delete(s.balances, address)
+		} else {
+			s.balances[address] = account.Balance
+		}
+		if account.Nonce == 0 {
+			delete(s.nonces, address)
+		} else {
+			s.nonces[address] = account.Nonce
+		}
+	}
+	for id, c := range undo.campaigns {
+		if c == nil {
+			delete(s.campaigns, id)
+		} else {
+			s.campaigns[id] = c
+		}
+	}
+}
+
+// ApplyBlock applies every transaction of b in order, see ExecuteBlock. If
+// one of them is invalid the state is left untouched and a *ValidationError
+// naming it is returned.
+func (s *State) ApplyBlock(b *Block) error {
+	_, err := s.ExecuteBlock(b)
+	return err
+}
@@ -0,0 +1,238 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Roshan310/DaanVeer/mempool"
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// alice and bob are the sender hashes of aliceWallet and bobWallet.
+var (
+	aliceWallet = mustWallet()
+	bobWallet   = mustWallet()
+	alice       = wallet.PublicKeyHashRipeMD160(aliceWallet.PublicKey)
+	bob         = wallet.PublicKeyHashRipeMD160(bobWallet.PublicKey)
+)
+
+func mustWallet() *wallet.Wallet {
+	w := &wallet.Wallet{}
+	if err := w.GenerateKeyPair(); err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// sign signs tx with w and returns it.
+func sign(t *testing.T, w *wallet.Wallet, tx *Transactions) *Transactions {
+	t.Helper()
+	if err := tx.SignTransaction(w); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// signedTransfer returns a transfer of value from the owner of w to
+// recipient, signed by w.
+func signedTransfer(t *testing.T, w *wallet.Wallet, nonce uint64, recipient []byte, value Amount) *Transactions {
+	t.Helper()
+	sender := wallet.PublicKeyHashRipeMD160(w.PublicKey)
+	return sign(t, w, NewTransaction(testChainID, nonce, sender, recipient, value))
+}
+
+// newFundedChain returns a chain sealed by its Sealer in which alice
+// has been minted 10.00.
+func newFundedChain(t *testing.T) *Blockchain {
+	t.Helper()
+	bc := newTestChain(t)
+	bc.Sealer = newAuthority(t)
+	bc.Consensus = newTestPoA(bc.Sealer)
+	b := childBlock(bc, *NewTransaction(testChainID, 0, nil, alice, 10*amountScale))
+	seal(t, bc, bc.Sealer, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+func TestAddTransactionCountsPendingTransfers(t *testing.T) {
+	bc := newFundedChain(t)
+	if err := bc.AddTransaction(signedTransfer(t, aliceWallet, 0, bob, 6*amountScale)); err != nil {
+		t.Fatalf("first transfer: %v", err)
+	}
+	if err := bc.AddTransaction(signedTransfer(t, aliceWallet, 1, bob, 6*amountScale)); !errors.Is(err, mempool.ErrInsufficientFunds) {
+		t.Fatalf("second transfer: got %v, want %v", err, mempool.ErrInsufficientFunds)
+	}
+	if err := bc.AddTransaction(signedTransfer(t, aliceWallet, 1, bob, 4*amountScale)); err != nil {
+		t.Fatalf("third transfer: %v", err)
+	}
+	if _, err := bc.CreateBlock(bc.LastBlock().Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.BalanceOf(alice); got != 0 {
+		t.Errorf("alice has %s, want 0.00", got)
+	}
+	if got := bc.BalanceOf(bob); got != 10*amountScale {
+		t.Errorf("bob has %s, want 10.00", got)
+	}
+}
+
+func TestAddTransactionRejectsInvalidTransfers(t *testing.T) {
+	older := NewTransaction(testChainID, 0, alice, bob, amountScale)
+	older.Version--
+	tampered := signedTransfer(t, aliceWallet, 0, bob, amountScale)
+	tampered.Value++
+	foreignKey := signedTransfer(t, aliceWallet, 0, bob, amountScale)
+	foreignKey.SenderPublicKey = wallet.PublicKeyToFixedBytes(bobWallet.PublicKey)
+	tests := []struct {
+		name string
+		tx   *Transactions
+		want error
+	}{
+		{"no sender", NewTransaction(testChainID, 0, nil, bob, amountScale), ErrMissingSender},
+		{"older version", sign(t, aliceWallet, older), ErrTransactionVersion},
+		{"another chain", sign(t, aliceWallet, NewTransaction("other", 0, alice, bob, amountScale)), ErrWrongChain},
+		{"unsigned", NewTransaction(testChainID, 0, alice, bob, amountScale), ErrMissingPublicKey},
+		{"value changed after signing", tampered, ErrBadSignature},
+		{"key of another sender", foreignKey, ErrSenderKeyMismatch},
+		{"zero value", signedTransfer(t, aliceWallet, 0, bob, 0), ErrInvalidValue},
+		{"nonce gap", signedTransfer(t, aliceWallet, 1, bob, amountScale), mempool.ErrNonceGap},
+		{"one paisa more than the balance", signedTransfer(t, aliceWallet, 0, bob, 10*amountScale+1), mempool.ErrInsufficientFunds},
+		{"unknown sender", signedTransfer(t, bobWallet, 0, alice, 1), mempool.ErrInsufficientFunds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newFundedChain(t)
+			if err := bc.AddTransaction(tt.tx); !errors.Is(err, tt.want) {
+				t.Fatalf("AddTransaction: got %v, want %v", err, tt.want)
+			}
+			if bc.Pool.Len() != 0 {
+				t.Fatalf("pool holds %d transactions, want 0", bc.Pool.Len())
+			}
+		})
+	}
+}
+
+func TestAddBlockRejectsReplayedTransaction(t *testing.T) {
+	bc := newFundedChain(t)
+	transfer := signedTransfer(t, aliceWallet, 0, bob, amountScale)
+	if err := bc.AddTransaction(transfer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.CreateBlock(bc.LastBlock().Hash()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(transfer); !errors.Is(err, mempool.ErrNonceTooLow) {
+		t.Fatalf("AddTransaction: got %v, want %v", err, mempool.ErrNonceTooLow)
+	}
+
+	b := childBlock(bc, *transfer)
+	seal(t, bc, bc.Sealer, b)
+	err := bc.AddBlock(b)
+	var verr *ValidationError
+	if !errors.Is(err, ErrBadNonce) || !errors.As(err, &verr) || verr.Tx != 0 {
+		t.Fatalf("AddBlock: got %v, want %v in transaction 0", err, ErrBadNonce)
+	}
+	if got := bc.BalanceOf(bob); got != amountScale {
+		t.Errorf("bob has %s, want 1.00", got)
+	}
+}
+
+func TestAddBlockRejectsOverspending(t *testing.T) {
+	bc := newFundedChain(t)
+	b := childBlock(bc, *signedTransfer(t, aliceWallet, 0, bob, 6*amountScale), *signedTransfer(t, aliceWallet, 1, bob, 6*amountScale))
+	seal(t, bc, bc.Sealer, b)
+
+	err := bc.AddBlock(b)
+	var verr *ValidationError
+	if !errors.Is(err, ErrInsufficientFunds) || !errors.As(err, &verr) || verr.Tx != 1 {
+		t.Fatalf("AddBlock: got %v, want %v in transaction 1", err, ErrInsufficientFunds)
+	}
+	if got := bc.BalanceOf(alice); got != 10*amountScale {
+		t.Errorf("alice has %s, want 10.00", got)
+	}
+}
+
+func TestMintRequiresConsensus(t *testing.T) {
+	bc := newTestChain(t)
+	if err := bc.Mint(alice, 10*amountScale); !errors.Is(err, ErrUnsealedMint) {
+		t.Fatalf("Mint: got %v, want %v", err, ErrUnsealedMint)
+	}
+
+	bc.Consensus = NewPoA(keys(newAuthority(t)))
+	if err := bc.Mint(alice, 10*amountScale); err != nil {
+		t.Fatalf("Mint: %v", err)
+	}
+	if bc.Pool.Len() != 1 {
+		t.Fatalf("pool holds %d transactions, want 1", bc.Pool.Len())
+	}
+}
+
+func TestApplyTransactionToSelf(t *testing.T) {
+	s := NewState()
+	if err := s.ApplyTransaction(NewTransaction(testChainID, 0, nil, alice, 10*amountScale)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ApplyTransaction(signedTransfer(t, aliceWallet, 0, alice, 4*amountScale)); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.BalanceOf(alice); got != 10*amountScale {
+		t.Errorf("alice has %s, want 10.00", got)
+	}
+}
+
+func TestTransactionIDIgnoresSignature(t *testing.T) {
+	tx := signedTransfer(t, aliceWallet, 0, bob, amountScale)
+	id, hash := tx.ID(), tx.Hash()
+
+	// ECDSA signatures are randomised, so signing again gives other bytes.
+	sign(t, aliceWallet, tx)
+	if !bytes.Equal(tx.ID(), id) {
+		t.Errorf("ID changed from %x to %x after signing again", id, tx.ID())
+	}
+	if bytes.Equal(tx.Hash(), hash) {
+		t.Errorf("Hash stayed %x after signing again", hash)
+	}
+
+	// The high-S twin of the signature is what would let a third party change
+	// the bytes of the transaction; it must not verify.
+	sig, err := wallet.ParseSignature(tx.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	highS := new(big.Int).Sub(elliptic.P256().Params().N, sig.S())
+	highS.FillBytes(tx.Signature[32:])
+	if err := tx.Verify(); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("Verify of the high-S twin: got %v, want %v", err, ErrBadSignature)
+	}
+}
+
+func TestUndoRevertsBlock(t *testing.T) {
+	s := NewState()
+	if err := s.ApplyTransaction(NewTransaction(testChainID, 0, nil, alice, 10*amountScale)); err != nil {
+		t.Fatal(err)
+	}
+	create := typed(t, bobWallet, 0, newCampaignPayload(time.Now().Add(time.Hour), 5*amountScale), 0)
+	b := NewBlock(nil, []Transactions{
+		*create,
+		*typed(t, aliceWallet, 0, &DonatePayload{CampaignID: create.ID()}, 2*amountScale),
+		*signedTransfer(t, aliceWallet, 1, bob, amountScale),
+	})
+	next := s.Copy()
+	if _, err := next.ExecuteBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	undo := s.undoTo(next)
+	if len(undo.accounts) != 2 || len(undo.campaigns) != 1 {
+		t.Fatalf("undo records %d accounts and %d campaigns, want 2 and 1", len(undo.accounts), len(undo.campaigns))
+	}
+	next.revert(undo)
+	if !bytes.Equal(next.Root(), s.Root()) || len(next.campaigns) != 0 {
+		t.Fatalf("reverted state has root %x and %d campaigns, want %x and none", next.Root(), len(next.campaigns), s.Root())
+	}
+}
@@ -0,0 +1,229 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// statePathBits is the depth of the state tree: keys are placed by the bits
+// of their SHA-256.
+const statePathBits = 256
+
+// emptyStateHash is the hash of a subtree that holds no keys.
+var emptyStateHash = make([]byte, sha256.Size)
+
+// StateTree is a sparse Merkle tree over key/value pairs. Every key has a
+// fixed place in a tree of depth 256, given by the bits of SHA-256(key), so
+// the tree has one root for one set of pairs however it was built, and absent
+// keys can be proven absent.
+//
+// A subtree that holds a single key is represented by that key's leaf instead
+// of a chain of nodes down to depth 256, and an empty subtree by
+// emptyStateHash, so the tree costs O(n) hashes rather than O(256 n). Leaves
+// and nodes are hashed with the MerkleSchemeTagged primitives, and a leaf
+// commits to its path as well as its value so that a leaf moved up the tree
+// still belongs to exactly one key.
+type StateTree struct {
+	// leaves maps the path of every key to the hash of its value.
+	leaves map[string][]byte
+}
+
+type stateLeaf struct {
+	path      []byte
+	valueHash []byte
+}
+
+func NewStateTree() *StateTree {
+	return &StateTree{leaves: make(map[string][]byte)}
+}
+
+func statePath(key []byte) []byte {
+	path := sha256.Sum256(key)
+	return path[:]
+}
+
+func stateBit(path []byte, i int) byte {
+	return path[i/8] >> (7 - i%8) & 1
+}
+
+func stateLeafHash(path []byte, valueHash []byte) []byte {
+	return MerkleSchemeTagged.hashLeaf(append(append([]byte(nil), path...), valueHash...))
+}
+
+// Set stores value under key. A nil value removes the key.
+func (t *StateTree) Set(key []byte, value []byte) {
+	path := string(statePath(key))
+	if value == nil {
+		delete(t.leaves, path)
+		return
+	}
+	hash := sha256.Sum256(value)
+	t.leaves[path] = hash[:]
+}
+
+func (t *StateTree) sorted() []stateLeaf {
+	leaves := make([]stateLeaf, 0, len(t.leaves))
+	for path, valueHash := range t.leaves {
+		leaves = append(leaves, stateLeaf{[]byte(path), valueHash})
+	}
+	sort.Slice(leaves, func(i, j int) bool { return bytes.Compare(leaves[i].path, leaves[j].path) < 0 })
+	return leaves
+}
+
+// splitState splits leaves, sorted and sharing their first depth bits, by
+// the bit at depth.
+func splitState(leaves []stateLeaf, depth int) int {
+	return sort.Search(len(leaves), func(i int) bool { return stateBit(leaves[i].path, depth) == 1 })
+}
+
+func stateSubtreeHash(leaves []stateLeaf, depth int) []byte {
+	switch len(leaves) {
+	case 0:
+		return emptyStateHash
+	case 1:
+		return stateLeafHash(leaves[0].path, leaves[0].valueHash)
+	}
+	split := splitState(leaves, depth)
+	return MerkleSchemeTagged.hashNode(stateSubtreeHash(leaves[:split], depth+1), stateSubtreeHash(leaves[split:], depth+1))
+}
+
+// Root returns the root hash of the tree. The root of an empty tree is 32
+// zero bytes.
+func (t *StateTree) Root() []byte {
+	return stateSubtreeHash(t.sorted(), 0)
+}
+
+// StateProof proves that a key has a given value in a state tree, or that it
+// is not in the tree at all.
+type StateProof struct {
+	// Siblings are the hashes next to the key's path, from the root down,
+	// until the path reaches a subtree holding at most one key.
+	Siblings [][]byte
+	// Leaf is the one key in that subtree, if any. For a proof of absence it
+	// is another key, whose path shares its first len(Siblings) bits with the
+	// absent one.
+	Leaf *StateProofLeaf
+}
+
+type StateProofLeaf struct {
+	Path      []byte
+	ValueHash []byte
+}
+
+// Prove returns a proof for key, of its value if the tree holds it and of its
+// absence otherwise.
+func (t *StateTree) Prove(key []byte) *StateProof {
+	path := statePath(key)
+	leaves := t.sorted()
+	proof := &StateProof{}
+	for depth := 0; len(leaves) > 1; depth++ {
+		split := splitState(leaves, depth)
+		if stateBit(path, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, stateSubtreeHash(leaves[split:], depth+1))
+			leaves = leaves[:split]
+		} else {
+			proof.Siblings = append(proof.Siblings, stateSubtreeHash(leaves[:split], depth+1))
+			leaves = leaves[split:]
+		}
+	}
+	if len(leaves) == 1 {
+		proof.Leaf = &StateProofLeaf{Path: leaves[0].path, ValueHash: leaves[0].valueHash}
+	}
+	return proof
+}
+
+// VerifyStateProof reports whether proof shows that key has value in the
+// state tree with the given root or, if value is nil, that key is not in it.
+func VerifyStateProof(root []byte, key []byte, value []byte, proof *StateProof) bool {
+	if proof == nil || len(proof.Siblings) > statePathBits {
+		return false
+	}
+	path := statePath(key)
+	depth := len(proof.Siblings)
+
+	var hash []byte
+	switch {
+	case value != nil:
+		valueHash := sha256.Sum256(value)
+		if proof.Leaf == nil || !bytes.Equal(proof.Leaf.Path, path) || !bytes.Equal(proof.Leaf.ValueHash, valueHash[:]) {
+			return false
+		}
+		hash = stateLeafHash(path, valueHash[:])
+	case proof.Leaf == nil:
+		hash = emptyStateHash
+	default:
+		if len(proof.Leaf.Path) != len(path) || bytes.Equal(proof.Leaf.Path, path) {
+			return false
+		}
+		for i := 0; i < depth; i++ {
+			if stateBit(proof.Leaf.Path, i) != stateBit(path, i) {
+				return false
+			}
+		}
+		hash = stateLeafHash(proof.Leaf.Path, proof.Leaf.ValueHash)
+	}
+
+	for i := depth - 1; i >= 0; i-- {
+		if stateBit(path, i) == 0 {
+			hash = MerkleSchemeTagged.hashNode(hash, proof.Siblings[i])
+		} else {
+			hash = MerkleSchemeTagged.hashNode(proof.Siblings[i], hash)
+		}
+	}
+	return bytes.Equal(hash, root)
+}
+
+type stateProofJSON struct {
+	Siblings []string            `json:"siblings"`
+	Leaf     *stateProofLeafJSON `json:"leaf,omitempty"`
+}
+
+type stateProofLeafJSON struct {
+	Path      string `json:"path"`
+	ValueHash string `json:"value_hash"`
+}
+
+// MarshalJSON writes hashes as hex strings.
+func (p *StateProof) MarshalJSON() ([]byte, error) {
+	var v stateProofJSON
+	v.Siblings = make([]string, len(p.Siblings))
+	for i, sibling := range p.Siblings {
+		v.Siblings[i] = hex.EncodeToString(sibling)
+	}
+	if p.Leaf != nil {
+		v.Leaf = &stateProofLeafJSON{hex.EncodeToString(p.Leaf.Path), hex.EncodeToString(p.Leaf.ValueHash)}
+	}
+	return json.Marshal(v)
+}
+
+func (p *StateProof) UnmarshalJSON(data []byte) error {
+	var v stateProofJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	proof := StateProof{}
+	for _, s := range v.Siblings {
+		sibling, err := hex.DecodeString(s)
+		if err != nil {
+			return fmt.Errorf("invalid sibling hash: %w", err)
+		}
+		proof.Siblings = append(proof.Siblings, sibling)
+	}
+	if v.Leaf != nil {
+		path, err := hex.DecodeString(v.Leaf.Path)
+		if err != nil {
+			return fmt.Errorf("invalid leaf path: %w", err)
+		}
+		valueHash, err := hex.DecodeString(v.Leaf.ValueHash)
+		if err != nil {
+			return fmt.Errorf("invalid leaf value hash: %w", err)
+		}
+		proof.Leaf = &StateProofLeaf{Path: path, ValueHash: valueHash}
+	}
+	*p = proof
+	return nil
+}
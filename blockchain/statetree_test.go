@@ -0,0 +1,215 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// keyNear returns a key other than key whose path shares its first bits bits
+// with the path of key.
+func keyNear(t *testing.T, key []byte, bits int) []byte {
+	t.Helper()
+	path := statePath(key)
+	for i := 0; i < 1<<20; i++ {
+		candidate := []byte(fmt.Sprintf("near-%d", i))
+		other := statePath(candidate)
+		shared := 0
+		for shared < bits && stateBit(other, shared) == stateBit(path, shared) {
+			shared++
+		}
+		if shared == bits && stateBit(other, bits) != stateBit(path, bits) {
+			return candidate
+		}
+	}
+	t.Fatalf("no key shares %d bits with %q", bits, key)
+	return nil
+}
+
+// keyAway returns a key whose path differs from the path of key in the first
+// bit.
+func keyAway(t *testing.T, key []byte) []byte {
+	t.Helper()
+	return keyNear(t, key, 0)
+}
+
+// newStateTree returns a tree holding every key of pairs with its value.
+func newStateTree(pairs map[string]string) *StateTree {
+	tree := NewStateTree()
+	for key, value := range pairs {
+		tree.Set([]byte(key), []byte(value))
+	}
+	return tree
+}
+
+func TestStateTreeProve(t *testing.T) {
+	a := []byte("a")
+	// near shares ten path bits with a and far is on the other side of the
+	// root from both, so the tree has a long shared path and an empty half.
+	near, far := keyNear(t, a, 10), keyAway(t, a)
+	nearA := keyNear(t, a, 12)
+	farSibling := keyNear(t, far, 3)
+
+	tests := []struct {
+		name     string
+		pairs    map[string]string
+		key      []byte
+		value    []byte
+		wantLeaf []byte
+	}{
+		{"only key", map[string]string{"a": "1"}, a, []byte("1"), a},
+		{"key next to a neighbour", map[string]string{"a": "1", string(near): "2", string(far): "3"}, a, []byte("1"), a},
+		{"neighbour sharing a prefix", map[string]string{"a": "1", string(near): "2", string(far): "3"}, near, []byte("2"), near},
+		{"empty tree", nil, a, nil, nil},
+		{"absent next to the only key", map[string]string{"a": "1"}, far, nil, a},
+		{"absent key sharing a prefix with a leaf", map[string]string{"a": "1", string(far): "3"}, nearA, nil, a},
+		{"absent key in an empty subtree", map[string]string{"a": "1", string(near): "2"}, far, nil, nil},
+		{"absent key among neighbours", map[string]string{"a": "1", string(near): "2", string(far): "3", string(farSibling): "4"}, nearA, nil, a},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newStateTree(tt.pairs)
+			root := tree.Root()
+			proof := tree.Prove(tt.key)
+			if !VerifyStateProof(root, tt.key, tt.value, proof) {
+				t.Fatal("proof does not verify")
+			}
+			switch {
+			case tt.wantLeaf == nil && proof.Leaf != nil:
+				t.Fatalf("proof ends in leaf %x, want an empty subtree", proof.Leaf.Path)
+			case tt.wantLeaf != nil && (proof.Leaf == nil || !bytes.Equal(proof.Leaf.Path, statePath(tt.wantLeaf))):
+				t.Fatalf("proof ends in %+v, want the leaf of %q", proof.Leaf, tt.wantLeaf)
+			}
+
+			// The same proof must not back any other claim about the key.
+			if tt.value != nil && VerifyStateProof(root, tt.key, nil, proof) {
+				t.Error("proof of inclusion also proves absence")
+			}
+			if VerifyStateProof(root, tt.key, []byte("other"), proof) {
+				t.Error("proof verifies another value")
+			}
+		})
+	}
+}
+
+func TestStateTreeRootIgnoresOrder(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+	forward := NewStateTree()
+	for _, key := range keys {
+		forward.Set([]byte(key), []byte("v"+key))
+	}
+	backward := NewStateTree()
+	for i := len(keys) - 1; i >= 0; i-- {
+		backward.Set([]byte(keys[i]), []byte("v"+keys[i]))
+	}
+	// A key set twice and one set and removed leave no trace.
+	rewritten := NewStateTree()
+	rewritten.Set([]byte("c"), []byte("old"))
+	rewritten.Set([]byte("x"), []byte("gone"))
+	for _, key := range []string{"d", "b", "e", "a", "c"} {
+		rewritten.Set([]byte(key), []byte("v"+key))
+	}
+	rewritten.Set([]byte("x"), nil)
+
+	root := forward.Root()
+	if !bytes.Equal(backward.Root(), root) {
+		t.Errorf("root in reverse order = %x, want %x", backward.Root(), root)
+	}
+	if !bytes.Equal(rewritten.Root(), root) {
+		t.Errorf("root after rewrites = %x, want %x", rewritten.Root(), root)
+	}
+}
+
+func TestStateTreeDelete(t *testing.T) {
+	tree := newStateTree(map[string]string{"a": "1", "b": "2", "c": "3"})
+	before := tree.Root()
+	proof := tree.Prove([]byte("b"))
+
+	tree.Set([]byte("b"), nil)
+	after := tree.Root()
+	if want := newStateTree(map[string]string{"a": "1", "c": "3"}).Root(); !bytes.Equal(after, want) {
+		t.Fatalf("root after delete = %x, want %x", after, want)
+	}
+	if !VerifyStateProof(after, []byte("b"), nil, tree.Prove([]byte("b"))) {
+		t.Error("absence of the deleted key does not verify")
+	}
+	if !VerifyStateProof(before, []byte("b"), []byte("2"), proof) {
+		t.Error("old proof no longer verifies against the old root")
+	}
+	if VerifyStateProof(after, []byte("b"), []byte("2"), proof) {
+		t.Error("old proof verifies against the new root")
+	}
+
+	tree.Set([]byte("a"), nil)
+	tree.Set([]byte("c"), nil)
+	if !bytes.Equal(tree.Root(), emptyStateHash) {
+		t.Errorf("root of an emptied tree = %x, want %x", tree.Root(), emptyStateHash)
+	}
+}
+
+func TestVerifyStateProofRejectsTampered(t *testing.T) {
+	pairs := map[string]string{}
+	for i := 0; i < 16; i++ {
+		pairs[fmt.Sprint(i)] = fmt.Sprint("value", i)
+	}
+	tree := newStateTree(pairs)
+	root := tree.Root()
+	key, value := []byte("3"), []byte("value3")
+	absent := []byte("absent")
+
+	tests := []struct {
+		name   string
+		key    []byte
+		value  []byte
+		tamper func(p *StateProof)
+	}{
+		{"flipped sibling", key, value, func(p *StateProof) { p.Siblings[0][0] ^= 1 }},
+		{"flipped last sibling", key, value, func(p *StateProof) { p.Siblings[len(p.Siblings)-1][31] ^= 1 }},
+		{"swapped siblings", key, value, func(p *StateProof) {
+			p.Siblings[0], p.Siblings[1] = p.Siblings[1], p.Siblings[0]
+		}},
+		{"missing sibling", key, value, func(p *StateProof) { p.Siblings = p.Siblings[1:] }},
+		{"extra sibling", key, value, func(p *StateProof) { p.Siblings = append(p.Siblings, emptyStateHash) }},
+		{"leaf value", key, value, func(p *StateProof) { p.Leaf.ValueHash = bytes.Repeat([]byte{1}, 32) }},
+		{"leaf dropped", key, value, func(p *StateProof) { p.Leaf = nil }},
+		{"absence with a flipped sibling", absent, nil, func(p *StateProof) { p.Siblings[0][0] ^= 1 }},
+		{"absence with the leaf of the key itself", absent, nil, func(p *StateProof) {
+			p.Leaf = &StateProofLeaf{Path: statePath(absent), ValueHash: make([]byte, 32)}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof := tree.Prove(tt.key)
+			if !VerifyStateProof(root, tt.key, tt.value, proof) {
+				t.Fatal("untampered proof does not verify")
+			}
+			// A sibling can be emptyStateHash itself, so tamper with copies.
+			for i := range proof.Siblings {
+				proof.Siblings[i] = append([]byte(nil), proof.Siblings[i]...)
+			}
+			tt.tamper(proof)
+			if VerifyStateProof(root, tt.key, tt.value, proof) {
+				t.Fatal("tampered proof verifies")
+			}
+		})
+	}
+}
+
+func TestProveAccount(t *testing.T) {
+	bc := newFundedChain(t)
+	root := bc.LastBlock().Header.StateRoot
+
+	account, proof := bc.ProveAccount(alice)
+	if account.Balance != 10*amountScale || !VerifyAccountProof(root, alice, account, proof) {
+		t.Fatalf("account of alice %+v does not verify against the head", account)
+	}
+	account.Balance++
+	if VerifyAccountProof(root, alice, account, proof) {
+		t.Fatal("proof verifies a balance alice does not have")
+	}
+
+	account, proof = bc.ProveAccount(bob)
+	if account != (Account{}) || !VerifyAccountProof(root, bob, account, proof) {
+		t.Fatalf("absence of bob %+v does not verify against the head", account)
+	}
+}
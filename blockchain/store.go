@@ -0,0 +1,217 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrBlockNotFound is returned by a BlockStore when no block matches a lookup.
+	ErrBlockNotFound = errors.New("block not found")
+	// ErrMetaNotFound is returned by GetMeta for a key that was never set.
+	ErrMetaNotFound = errors.New("metadata not found")
+	// ErrReceiptsNotFound is returned by GetReceipts for a block whose
+	// receipts were never stored.
+	ErrReceiptsNotFound = errors.New("receipts not found")
+)
+
+// BlockStore persists blocks and the pointer to the head of the chain, along
+// with the receipts of the blocks that have been executed and small pieces of
+// chain metadata such as the finalized block.
+//
+// Blocks are addressed by hash. The height index always follows the chain
+// that ends at the current head, so GetBlockByHeight and Iterate only ever
+// see the canonical chain even if side blocks have been stored.
+type BlockStore interface {
+	// PutBlock stores a block under its hash. Storing a block twice is a no-op.
+	PutBlock(b *Block) error
+	// GetBlock returns the block with the given hash.
+	GetBlock(hash []byte) (*Block, error)
+	// GetHeader returns only the header of the block with the given hash.
+	GetHeader(hash []byte) (*BlockHeader, error)
+	// GetBlockByHeight returns the canonical block at the given height.
+	GetBlockByHeight(height uint64) (*Block, error)
+	// Head returns the block the head pointer refers to.
+	Head() (*Block, error)
+	// SetHead moves the head pointer to an already stored block.
+	SetHead(hash []byte) error
+	// Iterate calls fn for every canonical block from genesis to head and
+	// stops at the first error.
+	Iterate(fn func(*Block) error) error
+	// PutReceipts stores the receipts of the block with the given hash.
+	// Storing them twice is a no-op.
+	PutReceipts(hash []byte, receipts []*Receipt) error
+	// GetReceipts returns the receipts of the block with the given hash.
+	GetReceipts(hash []byte) ([]*Receipt, error)
+	// PutMeta stores value under key, replacing any earlier value.
+	PutMeta(key string, value []byte) error
+	// GetMeta returns the value stored under key.
+	GetMeta(key string) ([]byte, error)
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// canonicalIndex maps heights to block hashes along the chain ending at the
+// head. It is shared by the store implementations.
+type canonicalIndex struct {
+	hashes [][]byte
+}
+
+// rebuild walks back from head through PreviousHash links and replaces every
+// height entry that no longer belongs to the chain ending at head.
+func (ci *canonicalIndex) rebuild(head *BlockHeader, get func(hash []byte) (*BlockHeader, error)) error {
+	height := head.Height
+	if uint64(len(ci.hashes)) > height+1 {
+		ci.hashes = ci.hashes[:height+1]
+	}
+	for uint64(len(ci.hashes)) < height+1 {
+		ci.hashes = append(ci.hashes, nil)
+	}
+
+	h := head
+	for {
+		hash := h.Hash()
+		if bytes.Equal(ci.hashes[h.Height], hash) {
+			return nil
+		}
+		ci.hashes[h.Height] = hash
+		if h.Height == 0 {
+			return nil
+		}
+		parent, err := get(h.PreviousHash)
+		if err != nil {
+			return fmt.Errorf("missing parent of block %d: %w", h.Height, err)
+		}
+		if parent.Height+1 != h.Height {
+			return fmt.Errorf("block %d has parent at height %d", h.Height, parent.Height)
+		}
+		h = parent
+	}
+}
+
+func (ci *canonicalIndex) clone() canonicalIndex {
+	return canonicalIndex{hashes: append([][]byte(nil), ci.hashes...)}
+}
+
+func (ci *canonicalIndex) at(height uint64) ([]byte, error) {
+	if height >= uint64(len(ci.hashes)) {
+		return nil, ErrBlockNotFound
+	}
+	return ci.hashes[height], nil
+}
+
+// MemoryStore is a BlockStore that keeps everything in memory. It is the
+// behaviour the blockchain had before blocks were persisted and is handy for
+// tests and throwaway nodes.
+type MemoryStore struct {
+	blocks   map[string]*Block
+	head     []byte
+	index    canonicalIndex
+	receipts map[string][]byte
+	meta     map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blocks: make(map[string]*Block), receipts: make(map[string][]byte), meta: make(map[string][]byte)}
+}
+
+func (ms *MemoryStore) PutBlock(b *Block) error {
+	key := hex.EncodeToString(b.Hash())
+	if _, ok := ms.blocks[key]; !ok {
+		ms.blocks[key] = b
+	}
+	return nil
+}
+
+func (ms *MemoryStore) GetBlock(hash []byte) (*Block, error) {
+	b, ok := ms.blocks[hex.EncodeToString(hash)]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return b, nil
+}
+
+func (ms *MemoryStore) GetHeader(hash []byte) (*BlockHeader, error) {
+	b, err := ms.GetBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &b.Header, nil
+}
+
+func (ms *MemoryStore) GetBlockByHeight(height uint64) (*Block, error) {
+	hash, err := ms.index.at(height)
+	if err != nil {
+		return nil, err
+	}
+	return ms.GetBlock(hash)
+}
+
+func (ms *MemoryStore) Head() (*Block, error) {
+	if ms.head == nil {
+		return nil, ErrBlockNotFound
+	}
+	return ms.GetBlock(ms.head)
+}
+
+func (ms *MemoryStore) SetHead(hash []byte) error {
+	b, err := ms.GetBlock(hash)
+	if err != nil {
+		return err
+	}
+	if err := ms.index.rebuild(&b.Header, ms.GetHeader); err != nil {
+		return err
+	}
+	ms.head = hash
+	return nil
+}
+
+func (ms *MemoryStore) Iterate(fn func(*Block) error) error {
+	for _, hash := range ms.index.hashes {
+		b, err := ms.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutReceipts keeps the receipts encoded, so callers that change a receipt
+// they got back do not change the stored one.
+func (ms *MemoryStore) PutReceipts(hash []byte, receipts []*Receipt) error {
+	key := hex.EncodeToString(hash)
+	if _, ok := ms.receipts[key]; !ok {
+		ms.receipts[key] = EncodeReceipts(receipts)
+	}
+	return nil
+}
+
+func (ms *MemoryStore) GetReceipts(hash []byte) ([]*Receipt, error) {
+	data, ok := ms.receipts[hex.EncodeToString(hash)]
+	if !ok {
+		return nil, ErrReceiptsNotFound
+	}
+	return DecodeReceipts(data)
+}
+
+func (ms *MemoryStore) PutMeta(key string, value []byte) error {
+	ms.meta[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (ms *MemoryStore) GetMeta(key string) ([]byte, error) {
+	value, ok := ms.meta[key]
+	if !ok {
+		return nil, ErrMetaNotFound
+	}
+	return value, nil
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
@@ -2,58 +2,128 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
-	"math/big"
+	"time"
 
 	"github.com/Roshan310/DaanVeer/wallet"
 )
 
+// TransactionVersion is the version of transactions created by this code.
+// Like BlockVersion it decides which fields are encoded, and only the current
+// version is accepted, so that no transaction can fall back on the weaker
+// rules of an older one.
+//
+//	1  original transaction, without a version field
+//	2  adds the chain ID and sender nonce
+//	3  adds the sender public key
+//	4  signs with a fixed-size, low-S wallet.Signature
+//	5  adds the kind and payload
+const TransactionVersion uint32 = 5
+
+var (
+	ErrMissingPublicKey  = errors.New("transaction carries no sender public key")
+	ErrSenderKeyMismatch = errors.New("sender public key does not hash to the sender")
+)
 
 type Transactions struct {
-	SenderHash    []byte
-	RecipientHash []byte
-	Value         float32
-	Signature     []byte
-	Timestamp     uint64
+	Version uint32
+	// ChainID names the network the transaction is meant for, so it cannot be
+	// replayed on another one.
+	ChainID string
+	// Nonce is the number of transactions the sender made before this one.
+	// Each nonce can be used once, so the transaction cannot be replayed on
+	// the same network either.
+	Nonce uint64
+	// SenderPublicKey is the key the transaction is signed with, in the
+	// fixed 64-byte form of wallet.PublicKeyToFixedBytes. It must hash to
+	// SenderHash.
+	SenderPublicKey []byte
+	SenderHash      []byte
+	RecipientHash   []byte
+	Value           Amount
+	// Signature is a wallet.Signature.
+	Signature []byte
+	Timestamp uint64
+	// Kind says what the transaction does and Payload holds the arguments
+	// of that kind, see TxKind.
+	Kind    TxKind
+	Payload []byte
+}
+
+func NewTransaction(chainID string, nonce uint64, sender []byte, recipient []byte, value Amount) *Transactions {
+	return &Transactions{
+		Version:       TransactionVersion,
+		ChainID:       chainID,
+		Nonce:         nonce,
+		SenderHash:    sender,
+		RecipientHash: recipient,
+		Value:         value,
+		Timestamp:     uint64(time.Now().UnixNano()),
+	}
 }
 
-func NewTransaction(sender []byte, recipient []byte, value float32) *Transactions {
-	return &Transactions{SenderHash: sender, RecipientHash: recipient, Value: value}
+// IsMint reports whether the transaction creates funds instead of moving
+// them from a sender.
+func (t *Transactions) IsMint() bool {
+	return len(t.SenderHash) == 0
 }
 
 func (t *Transactions) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 40))
 	fmt.Printf("Sender Address:    %s\n", t.SenderHash)
 	fmt.Printf("Recipient Address: %s\n", t.RecipientHash)
-	fmt.Printf("Value:                        %.1f\n", t.Value)
+	fmt.Printf("Value:                        %s\n", t.Value)
+	fmt.Printf("Nonce:             %d\n", t.Nonce)
 	fmt.Printf("Signature: %s", t.Signature)
 	fmt.Printf("Timestamp %d", t.Timestamp)
 }
 
 func (t *Transactions) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_address"`
-		Recipient string  `json:"recipient_address"`
-		Value     float32 `json:"value"`
+		ChainID   string `json:"chain_id"`
+		Nonce     uint64 `json:"nonce"`
+		Sender    string `json:"sender_address"`
+		Recipient string `json:"recipient_address"`
+		Value     Amount `json:"value"`
+		Kind      TxKind `json:"kind"`
+		Payload   []byte `json:"payload,omitempty"`
 	}{
+		ChainID:   t.ChainID,
+		Nonce:     t.Nonce,
 		Sender:    string(t.SenderHash),
 		Recipient: string(t.RecipientHash),
 		Value:     t.Value,
+		Kind:      t.Kind,
+		Payload:   t.Payload,
 	})
 }
 
+// Hash returns the SHA-256 of the transaction's canonical encoding,
+// signature included.
 func (t *Transactions) Hash() []byte {
-	m, _ := json.Marshal(t)
-	hash := sha256.Sum256(m)
+	hash := sha256.Sum256(EncodeTransaction(t))
 	return hash[:]
 }
 
+// SigningHash returns the hash that is signed: the canonical encoding of
+// every field except the signature itself.
+func (t *Transactions) SigningHash() []byte {
+	hash := sha256.Sum256(encodeTransaction(t, kindTransactionSigning))
+	return hash[:]
+}
+
+// ID identifies the transaction by what was signed rather than by the
+// signature, so it stays the same however the signature is re-encoded. Use it
+// instead of Hash to refer to a transaction.
+func (t *Transactions) ID() []byte {
+	return t.SigningHash()
+}
+
 func (tx Transaction) SerializeTransaction() ([]byte, error) {
 	var encoded bytes.Buffer
 	err := gob.NewEncoder(&encoded).Encode(tx)
@@ -77,25 +147,47 @@ func DeserializeTransaction(serializedTransaction []byte) (*Transaction, error)
 // 		return nil, err
 // 	}
 
-func (tx *Transactions) SignTransaction(wallet *wallet.Wallet) error {
-	senderPrivKey := wallet.PrivateKey
+// SignTransaction signs every field of the transaction except the signature
+// with the wallet's private key and attaches the wallet's public key. The
+// wallet must own the sender.
+func (tx *Transactions) SignTransaction(w *wallet.Wallet) error {
+	if !bytes.Equal(wallet.PublicKeyHashRipeMD160(w.PublicKey), tx.SenderHash) {
+		return ErrSenderKeyMismatch
+	}
+	tx.SenderPublicKey = wallet.PublicKeyToFixedBytes(w.PublicKey)
 
-	r, s, err := ecdsa.Sign(rand.Reader, senderPrivKey, tx.Hash())
+	signature, err := wallet.Sign(w.PrivateKey, tx.SigningHash())
 	if err != nil {
-		fmt.Println("failed to sign the transaction!!!")
+		return fmt.Errorf("failed to sign transaction: %w", err)
 	}
-	signature := append(r.Bytes(), s.Bytes()...)
-	tx.Signature = signature
+	tx.Signature = signature.Bytes()
 	return nil
 }
-func (tx *Transactions) VerifyTransaction(pubKey *ecdsa.PublicKey) bool {
-	signatureBytes := tx.Signature
-
-	r := new(big.Int).SetBytes(signatureBytes[:len(signatureBytes)/2])
-	s := new(big.Int).SetBytes(signatureBytes[len(signatureBytes)/2:])
 
-	hash := tx.Hash()
+// Verify checks that the sender public key belongs to the sender and that the
+// signature was made with it over the transaction. Mints have no sender and
+// nothing to verify.
+func (tx *Transactions) Verify() error {
+	if tx.IsMint() {
+		return nil
+	}
+	if len(tx.SenderPublicKey) == 0 {
+		return ErrMissingPublicKey
+	}
+	pubKey, err := wallet.BytesToPublicKey(tx.SenderPublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSenderKeyMismatch, err)
+	}
+	if !bytes.Equal(wallet.PublicKeyHashRipeMD160(pubKey), tx.SenderHash) {
+		return ErrSenderKeyMismatch
+	}
 
-	isValid := ecdsa.Verify(pubKey, hash[:], r, s)
-	return isValid
-}
\ No newline at end of file
+	signature, err := wallet.ParseSignature(tx.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if !signature.Verify(pubKey, tx.SigningHash()) {
+		return ErrBadSignature
+	}
+	return nil
+}
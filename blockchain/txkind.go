@@ -0,0 +1,386 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// TxKind says what a transaction does. Every kind other than TxTransfer has
+// a payload of its own, see Payload.
+type TxKind uint32
+
+const (
+	// TxTransfer moves Value from the sender to the recipient, or mints it
+	// for the recipient if there is no sender. It has no payload.
+	TxTransfer TxKind = iota
+	// TxDonate gives Value to a campaign, see DonatePayload.
+	TxDonate
+	// TxCreateCampaign opens a campaign owned by the sender, see
+	// CreateCampaignPayload.
+	TxCreateCampaign
+	// TxReleaseFunds pays the next milestone of a campaign out to its
+	// beneficiary, see ReleaseFundsPayload.
+	TxReleaseFunds
+	// TxRefund returns the sender's donations to a campaign that missed its
+	// goal, see RefundPayload.
+	TxRefund
+	// TxAuthorityVote is an authority's vote to add or revoke an authority,
+	// see AuthorityVotePayload.
+	TxAuthorityVote
+)
+
+var txKindNames = []string{"transfer", "donate", "create-campaign", "release-funds", "refund", "authority-vote"}
+
+func (k TxKind) String() string {
+	if int(k) < len(txKindNames) {
+		return txKindNames[k]
+	}
+	return "kind " + strconv.FormatUint(uint64(k), 10)
+}
+
+// MarshalText writes the kind by name, so JSON reads "donate" rather than 1.
+func (k TxKind) MarshalText() ([]byte, error) {
+	if int(k) >= len(txKindNames) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownTxKind, k)
+	}
+	return []byte(txKindNames[k]), nil
+}
+
+func (k *TxKind) UnmarshalText(text []byte) error {
+	for i, name := range txKindNames {
+		if name == string(text) {
+			*k = TxKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownTxKind, text)
+}
+
+var (
+	ErrUnknownTxKind  = errors.New("unknown transaction kind")
+	ErrInvalidPayload = errors.New("invalid transaction payload")
+)
+
+// Payload is the decoded payload of a transaction. Each kind has its own
+// payload type, which holds the rules of the kind: the ones that only need
+// the transaction, checked before it is pooled or accepted in a block, and
+// the state transition it makes when its block is executed.
+type Payload interface {
+	Kind() TxKind
+	encode() []byte
+	// check applies the rules that need nothing but tx.
+	check(tx *Transactions) error
+	// apply carries out tx, which is in the block with header h, on s. It
+	// leaves s untouched if it fails. Nonces are taken care of by the
+	// caller.
+	apply(s *State, tx *Transactions, h *BlockHeader) ([]Event, error)
+}
+
+// NewTypedTransaction returns a transaction of the payload's kind. value is
+// what the sender pays, which only donations carry.
+func NewTypedTransaction(chainID string, nonce uint64, sender []byte, payload Payload, value Amount) *Transactions {
+	tx := NewTransaction(chainID, nonce, sender, nil, value)
+	tx.Kind = payload.Kind()
+	tx.Payload = payload.encode()
+	return tx
+}
+
+// DecodePayload returns the payload of tx according to its kind.
+func (t *Transactions) DecodePayload() (Payload, error) {
+	var p Payload
+	var err error
+	switch t.Kind {
+	case TxTransfer:
+		p = &TransferPayload{}
+		if len(t.Payload) != 0 {
+			err = errors.New("transfers carry no payload")
+		}
+	case TxDonate:
+		var id []byte
+		id, err = decodeCampaignID(t.Payload, kindDonatePayload)
+		p = &DonatePayload{CampaignID: id}
+	case TxCreateCampaign:
+		p, err = decodeCreateCampaign(t.Payload)
+	case TxReleaseFunds:
+		p, err = decodeReleaseFunds(t.Payload)
+	case TxRefund:
+		var id []byte
+		id, err = decodeCampaignID(t.Payload, kindRefundPayload)
+		p = &RefundPayload{CampaignID: id}
+	case TxAuthorityVote:
+		p, err = decodeAuthorityVote(t.Payload)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnknownTxKind, t.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidPayload, t.Kind, err)
+	}
+	return p, nil
+}
+
+// CheckPayload checks tx against the rules of its kind that need nothing but
+// the transaction itself: its payload must decode and make sense, and it
+// must carry a sender, a recipient and a value only where the kind calls for
+// them.
+func (t *Transactions) CheckPayload() error {
+	_, err := t.checkedPayload()
+	return err
+}
+
+func (t *Transactions) checkedPayload() (Payload, error) {
+	p, err := t.DecodePayload()
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind != TxTransfer {
+		if t.IsMint() {
+			return nil, ErrMissingSender
+		}
+		if len(t.RecipientHash) != 0 {
+			return nil, fmt.Errorf("%w: %s has no recipient", ErrInvalidPayload, t.Kind)
+		}
+	}
+	if err := p.check(t); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// noValue is the check of the kinds that move no funds from the sender.
+func noValue(tx *Transactions) error {
+	if tx.Value != 0 {
+		return fmt.Errorf("%w: %s carries no value", ErrInvalidPayload, tx.Kind)
+	}
+	return nil
+}
+
+// checkCampaignID checks that id can name a campaign: the ID of the
+// transaction that created it.
+func checkCampaignID(id []byte) error {
+	if len(id) != sha256.Size {
+		return fmt.Errorf("%w: campaign ID must be %d bytes", ErrInvalidPayload, sha256.Size)
+	}
+	return nil
+}
+
+// applyTransaction checks the nonce of tx, carries it out and uses up the
+// nonce. h is the header of the block tx is in; transfers do not need it.
+func (s *State) applyTransaction(tx *Transactions, h *BlockHeader) ([]Event, error) {
+	p, err := tx.checkedPayload()
+	if err != nil {
+		return nil, err
+	}
+	checkNonce := !tx.IsMint()
+	if checkNonce && tx.Nonce != s.nonces[string(tx.SenderHash)] {
+		return nil, fmt.Errorf("%w: %s is at %d, got %d", ErrBadNonce, wallet.AddressFromPubKeyHash(tx.SenderHash), s.nonces[string(tx.SenderHash)], tx.Nonce)
+	}
+	events, err := p.apply(s, tx, h)
+	if err != nil {
+		return nil, err
+	}
+	if checkNonce {
+		s.nonces[string(tx.SenderHash)]++
+	}
+	return events, nil
+}
+
+// TransferPayload is the empty payload of a transfer or mint.
+type TransferPayload struct{}
+
+func (p *TransferPayload) Kind() TxKind   { return TxTransfer }
+func (p *TransferPayload) encode() []byte { return nil }
+
+func (p *TransferPayload) check(tx *Transactions) error {
+	if tx.Value == 0 {
+		return ErrInvalidValue
+	}
+	if len(tx.RecipientHash) == 0 {
+		return ErrMissingRecipient
+	}
+	return nil
+}
+
+// apply checks the sender before the recipient, so an overspend is reported
+// as such whatever the recipient holds.
+func (p *TransferPayload) apply(s *State, tx *Transactions, h *BlockHeader) ([]Event, error) {
+	balance := s.balances[string(tx.SenderHash)]
+	var debited Amount
+	if !tx.IsMint() {
+		var err error
+		if debited, err = balance.Sub(tx.Value); err != nil {
+			return nil, insufficientFunds(tx, balance)
+		}
+	}
+	credited, err := s.balances[string(tx.RecipientHash)].Add(tx.Value)
+	if err != nil {
+		return nil, err
+	}
+	if !tx.IsMint() {
+		s.balances[string(tx.SenderHash)] = debited
+		if string(tx.SenderHash) == string(tx.RecipientHash) {
+			credited = balance
+		}
+	}
+	s.balances[string(tx.RecipientHash)] = credited
+	return transferEvents(tx), nil
+}
+
+// insufficientFunds is the error of tx, whose sender holds only balance.
+func insufficientFunds(tx *Transactions, balance Amount) error {
+	return fmt.Errorf("%w: %s has %s, needs %s", ErrInsufficientFunds, wallet.AddressFromPubKeyHash(tx.SenderHash), balance, tx.Value)
+}
+
+// DonatePayload names the campaign a donation is for. The donation is the
+// transaction's Value.
+type DonatePayload struct {
+	CampaignID []byte
+}
+
+func (p *DonatePayload) Kind() TxKind { return TxDonate }
+
+func (p *DonatePayload) encode() []byte {
+	return encodeCampaignID(kindDonatePayload, p.CampaignID)
+}
+
+func (p *DonatePayload) check(tx *Transactions) error {
+	if tx.Value == 0 {
+		return ErrInvalidValue
+	}
+	return checkCampaignID(p.CampaignID)
+}
+
+// MaxMilestones is the most milestones a campaign can have.
+const MaxMilestones = 64
+
+// CreateCampaignPayload describes a new campaign. The campaign's ID is the
+// ID of the transaction and its owner the sender. Funds are released to the
+// beneficiary milestone by milestone; the milestones must add up to the
+// goal.
+type CreateCampaignPayload struct {
+	Beneficiary []byte
+	Goal        Amount
+	// Deadline is the block time, in Unix nanoseconds, from which the
+	// campaign takes no more donations.
+	Deadline uint64
+	// DescriptionHash is the SHA-256 of the campaign description, which is
+	// kept off the chain.
+	DescriptionHash []byte
+	Milestones      []Amount
+}
+
+func (p *CreateCampaignPayload) Kind() TxKind   { return TxCreateCampaign }
+func (p *CreateCampaignPayload) encode() []byte { return encodeCreateCampaign(p) }
+
+func (p *CreateCampaignPayload) check(tx *Transactions) error {
+	if err := noValue(tx); err != nil {
+		return err
+	}
+	switch {
+	case len(p.Beneficiary) == 0:
+		return fmt.Errorf("%w: campaign has no beneficiary", ErrInvalidPayload)
+	case p.Goal == 0:
+		return fmt.Errorf("%w: campaign goal must be positive", ErrInvalidPayload)
+	case p.Deadline == 0:
+		return fmt.Errorf("%w: campaign has no deadline", ErrInvalidPayload)
+	case len(p.DescriptionHash) != sha256.Size:
+		return fmt.Errorf("%w: description hash must be %d bytes", ErrInvalidPayload, sha256.Size)
+	case len(p.Milestones) == 0 || len(p.Milestones) > MaxMilestones:
+		return fmt.Errorf("%w: campaign must have 1 to %d milestones", ErrInvalidPayload, MaxMilestones)
+	}
+	var total Amount
+	for i, milestone := range p.Milestones {
+		if milestone == 0 {
+			return fmt.Errorf("%w: milestone %d is empty", ErrInvalidPayload, i)
+		}
+		var err error
+		if total, err = total.Add(milestone); err != nil {
+			return fmt.Errorf("%w: milestones: %v", ErrInvalidPayload, err)
+		}
+	}
+	if total != p.Goal {
+		return fmt.Errorf("%w: milestones add up to %s, goal is %s", ErrInvalidPayload, total, p.Goal)
+	}
+	return nil
+}
+
+// ReleaseFundsPayload pays out a milestone of a campaign. Milestones are
+// released in order, so Milestone must be the next one.
+type ReleaseFundsPayload struct {
+	CampaignID []byte
+	Milestone  uint32
+}
+
+func (p *ReleaseFundsPayload) Kind() TxKind   { return TxReleaseFunds }
+func (p *ReleaseFundsPayload) encode() []byte { return encodeReleaseFunds(p) }
+
+func (p *ReleaseFundsPayload) check(tx *Transactions) error {
+	if err := noValue(tx); err != nil {
+		return err
+	}
+	return checkCampaignID(p.CampaignID)
+}
+
+// RefundPayload names the campaign the sender wants their donations back
+// from.
+type RefundPayload struct {
+	CampaignID []byte
+}
+
+func (p *RefundPayload) Kind() TxKind { return TxRefund }
+
+func (p *RefundPayload) encode() []byte {
+	return encodeCampaignID(kindRefundPayload, p.CampaignID)
+}
+
+func (p *RefundPayload) check(tx *Transactions) error {
+	if err := noValue(tx); err != nil {
+		return err
+	}
+	return checkCampaignID(p.CampaignID)
+}
+
+// AuthorityVotePayload is the vote of the sender, who must be an authority,
+// to add Candidate to the authorities or revoke it. It counts like a vote in
+// a block header, see Snapshot.ApplyBlock.
+type AuthorityVotePayload struct {
+	// Candidate is the candidate's public key in the fixed 64-byte form.
+	Candidate []byte
+	Authorize bool
+}
+
+func (p *AuthorityVotePayload) Kind() TxKind   { return TxAuthorityVote }
+func (p *AuthorityVotePayload) encode() []byte { return encodeAuthorityVote(p) }
+
+func (p *AuthorityVotePayload) check(tx *Transactions) error {
+	if err := noValue(tx); err != nil {
+		return err
+	}
+	if _, err := wallet.BytesToPublicKey(p.Candidate); err != nil || len(p.Candidate) != 64 {
+		return fmt.Errorf("%w: candidate is not a 64-byte public key", ErrInvalidPayload)
+	}
+	return nil
+}
+
+// apply changes nothing in the state: the vote is counted by the PoA
+// snapshot, which checks that the sender is an authority.
+func (p *AuthorityVotePayload) apply(s *State, tx *Transactions, h *BlockHeader) ([]Event, error) {
+	key, err := wallet.BytesToPublicKey(p.Candidate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return []Event{{Type: "authority-vote", Attributes: []EventAttribute{
+		{"voter", wallet.AddressFromPubKeyHash(tx.SenderHash)},
+		{"candidate", wallet.GenerateAddress(key)},
+		{"authorize", strconv.FormatBool(p.Authorize)},
+	}}}, nil
+}
+
+// campaignAttribute is the event attribute naming a campaign.
+func campaignAttribute(id []byte) EventAttribute {
+	return EventAttribute{"campaign", hex.EncodeToString(id)}
+}
@@ -0,0 +1,353 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// carol is an address without a wallet, used as a campaign beneficiary.
+var carol = bytes.Repeat([]byte{3}, 20)
+
+// newCampaignPayload returns the payload of a campaign for carol with the
+// given milestones, which make up its goal, taking donations until deadline.
+func newCampaignPayload(deadline time.Time, milestones ...Amount) *CreateCampaignPayload {
+	description := sha256.Sum256([]byte("description"))
+	var goal Amount
+	for _, milestone := range milestones {
+		goal += milestone
+	}
+	return &CreateCampaignPayload{
+		Beneficiary:     carol,
+		Goal:            goal,
+		Deadline:        uint64(deadline.UnixNano()),
+		DescriptionHash: description[:],
+		Milestones:      milestones,
+	}
+}
+
+// typed returns a transaction of the owner of w carrying payload, signed by w.
+func typed(t *testing.T, w *wallet.Wallet, nonce uint64, payload Payload, value Amount) *Transactions {
+	t.Helper()
+	sender := wallet.PublicKeyHashRipeMD160(w.PublicKey)
+	return sign(t, w, NewTypedTransaction(testChainID, nonce, sender, payload, value))
+}
+
+// createBlock pools txs and seals them into a new block on top of bc.
+func createBlock(t *testing.T, bc *Blockchain, txs ...*Transactions) *Block {
+	t.Helper()
+	for _, tx := range txs {
+		if err := bc.AddTransaction(tx); err != nil {
+			t.Fatalf("AddTransaction(%s): %v", tx.Kind, err)
+		}
+	}
+	b, err := bc.CreateBlock(bc.LastBlock().Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Transactions) != len(txs) {
+		t.Fatalf("block holds %d transactions, want %d", len(b.Transactions), len(txs))
+	}
+	return b
+}
+
+// checkReceipt fails the test unless tx has a receipt of the given status
+// and, for a failed one, an error reading like want.
+func checkReceipt(t *testing.T, bc *Blockchain, tx *Transactions, status ReceiptStatus, want error) {
+	t.Helper()
+	r, ok, err := bc.Receipt(tx.ID())
+	if err != nil || !ok {
+		t.Fatalf("Receipt of the %s = %v, %v", tx.Kind, ok, err)
+	}
+	if r.Status != status || (want != nil && !strings.Contains(r.Error, want.Error())) {
+		t.Fatalf("%s receipt is %s (%q), want %s (%v)", tx.Kind, r.Status, r.Error, status, want)
+	}
+}
+
+func TestCheckPayloadRejects(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	id := make([]byte, sha256.Size)
+	withPayload := func(tx *Transactions, payload []byte) *Transactions {
+		tx.Payload = payload
+		return tx
+	}
+	withRecipient := func(tx *Transactions) *Transactions {
+		tx.RecipientHash = bob
+		return tx
+	}
+	withKind := func(tx *Transactions, kind TxKind) *Transactions {
+		tx.Kind = kind
+		return tx
+	}
+	donate := NewTypedTransaction(testChainID, 0, alice, &DonatePayload{CampaignID: id}, 1)
+	campaign := func(p *CreateCampaignPayload) *Transactions {
+		return NewTypedTransaction(testChainID, 0, alice, p, 0)
+	}
+	unevenGoal := newCampaignPayload(deadline, amountScale)
+	unevenGoal.Goal++
+	shortDescription := newCampaignPayload(deadline, amountScale)
+	shortDescription.DescriptionHash = shortDescription.DescriptionHash[1:]
+	noBeneficiary := newCampaignPayload(deadline, amountScale)
+	noBeneficiary.Beneficiary = nil
+	tooManyMilestones := newCampaignPayload(deadline, make([]Amount, MaxMilestones+1)...)
+	for i := range tooManyMilestones.Milestones {
+		tooManyMilestones.Milestones[i] = 1
+	}
+	tooManyMilestones.Goal = MaxMilestones + 1
+
+	tests := []struct {
+		name string
+		tx   *Transactions
+		want error
+	}{
+		{"transfer without recipient", NewTransaction(testChainID, 0, alice, nil, 1), ErrMissingRecipient},
+		{"transfer with a payload", withPayload(NewTransaction(testChainID, 0, alice, bob, 1), []byte{1}), ErrInvalidPayload},
+		{"unknown kind", withKind(NewTransaction(testChainID, 0, alice, nil, 1), TxAuthorityVote+1), ErrUnknownTxKind},
+		{"donation without value", NewTypedTransaction(testChainID, 0, alice, &DonatePayload{CampaignID: id}, 0), ErrInvalidValue},
+		{"donation to a short campaign ID", NewTypedTransaction(testChainID, 0, alice, &DonatePayload{CampaignID: id[1:]}, 1), ErrInvalidPayload},
+		{"donation without sender", NewTypedTransaction(testChainID, 0, nil, &DonatePayload{CampaignID: id}, 1), ErrMissingSender},
+		{"donation with a recipient", withRecipient(NewTypedTransaction(testChainID, 0, alice, &DonatePayload{CampaignID: id}, 1)), ErrInvalidPayload},
+		{"truncated payload", withPayload(donate, donate.Payload[:len(donate.Payload)-1]), ErrInvalidPayload},
+		{"payload of another kind", withKind(NewTypedTransaction(testChainID, 0, alice, &RefundPayload{CampaignID: id}, 1), TxDonate), ErrInvalidPayload},
+		{"campaign with a value", NewTypedTransaction(testChainID, 0, alice, newCampaignPayload(deadline, amountScale), 1), ErrInvalidPayload},
+		{"campaign without beneficiary", campaign(noBeneficiary), ErrInvalidPayload},
+		{"milestones that miss the goal", campaign(unevenGoal), ErrInvalidPayload},
+		{"empty milestone", campaign(newCampaignPayload(deadline, amountScale, 0)), ErrInvalidPayload},
+		{"too many milestones", campaign(tooManyMilestones), ErrInvalidPayload},
+		{"short description hash", campaign(shortDescription), ErrInvalidPayload},
+		{"release with a value", NewTypedTransaction(testChainID, 0, alice, &ReleaseFundsPayload{CampaignID: id}, 1), ErrInvalidPayload},
+		{"vote for a short key", NewTypedTransaction(testChainID, 0, alice, &AuthorityVotePayload{Candidate: []byte{1}}, 0), ErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.tx.CheckPayload(); !errors.Is(err, tt.want) {
+				t.Fatalf("CheckPayload: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayloadRoundTrip(t *testing.T) {
+	id := bytes.Repeat([]byte{7}, sha256.Size)
+	payloads := []Payload{
+		&DonatePayload{CampaignID: id},
+		newCampaignPayload(time.Now(), amountScale, 2*amountScale),
+		&ReleaseFundsPayload{CampaignID: id, Milestone: 3},
+		&RefundPayload{CampaignID: id},
+		&AuthorityVotePayload{Candidate: wallet.PublicKeyToFixedBytes(bobWallet.PublicKey), Authorize: true},
+	}
+	for _, p := range payloads {
+		t.Run(p.Kind().String(), func(t *testing.T) {
+			tx := typed(t, aliceWallet, 0, p, 0)
+			decoded, err := DecodeTransaction(EncodeTransaction(tx))
+			if err != nil {
+				t.Fatalf("DecodeTransaction: %v", err)
+			}
+			if decoded.Kind != p.Kind() || decoded.Verify() != nil {
+				t.Fatalf("decoded a %s that verifies as %v, want a %s", decoded.Kind, decoded.Verify(), p.Kind())
+			}
+			got, err := decoded.DecodePayload()
+			if err != nil {
+				t.Fatalf("DecodePayload: %v", err)
+			}
+			if !reflect.DeepEqual(got, p) {
+				t.Fatalf("DecodePayload = %+v, want %+v", got, p)
+			}
+
+			text, err := p.Kind().MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kind TxKind
+			if err := kind.UnmarshalText(text); err != nil || kind != p.Kind() {
+				t.Fatalf("UnmarshalText(%s) = %s, %v", text, kind, err)
+			}
+		})
+	}
+
+	var kind TxKind
+	if err := kind.UnmarshalText([]byte("burn")); !errors.Is(err, ErrUnknownTxKind) {
+		t.Fatalf("UnmarshalText(burn): got %v, want %v", err, ErrUnknownTxKind)
+	}
+}
+
+func TestCampaignReleasesMilestones(t *testing.T) {
+	bc := newFundedChain(t)
+	create := typed(t, bobWallet, 0, newCampaignPayload(time.Now().Add(time.Hour), 2*amountScale, 4*amountScale), 0)
+	id := create.ID()
+	createBlock(t, bc, create)
+	checkReceipt(t, bc, create, ReceiptSuccess, nil)
+
+	// Nothing can be released before the goal is reached, but the attempt
+	// still uses up the owner's nonce. Donations beyond the goal are kept.
+	early := typed(t, bobWallet, 1, &ReleaseFundsPayload{CampaignID: id}, 0)
+	donate := typed(t, aliceWallet, 0, &DonatePayload{CampaignID: id}, 7*amountScale)
+	createBlock(t, bc, early, donate)
+	checkReceipt(t, bc, early, ReceiptFailed, ErrGoalNotReached)
+	checkReceipt(t, bc, donate, ReceiptSuccess, nil)
+	if got := bc.BalanceOf(alice); got != 3*amountScale {
+		t.Fatalf("alice has %s after donating, want 3.00", got)
+	}
+
+	// Milestones are released in order, only by the owner, and the last one
+	// pays out the rest of what was raised.
+	stranger := typed(t, aliceWallet, 1, &ReleaseFundsPayload{CampaignID: id}, 0)
+	outOfOrder := typed(t, bobWallet, 2, &ReleaseFundsPayload{CampaignID: id, Milestone: 1}, 0)
+	first := typed(t, bobWallet, 3, &ReleaseFundsPayload{CampaignID: id}, 0)
+	last := typed(t, bobWallet, 4, &ReleaseFundsPayload{CampaignID: id, Milestone: 1}, 0)
+	createBlock(t, bc, stranger, outOfOrder, first, last)
+	checkReceipt(t, bc, stranger, ReceiptFailed, ErrNotCampaignOwner)
+	checkReceipt(t, bc, outOfOrder, ReceiptFailed, ErrMilestoneOrder)
+	checkReceipt(t, bc, first, ReceiptSuccess, nil)
+	checkReceipt(t, bc, last, ReceiptSuccess, nil)
+	if got := bc.BalanceOf(carol); got != 7*amountScale {
+		t.Fatalf("beneficiary has %s, want 7.00", got)
+	}
+
+	late := typed(t, aliceWallet, 2, &DonatePayload{CampaignID: id}, amountScale)
+	unknown := typed(t, aliceWallet, 3, &DonatePayload{CampaignID: make([]byte, sha256.Size)}, amountScale)
+	createBlock(t, bc, late, unknown)
+	checkReceipt(t, bc, late, ReceiptFailed, ErrCampaignPaidOut)
+	checkReceipt(t, bc, unknown, ReceiptFailed, ErrUnknownCampaign)
+	if got, nonce := bc.BalanceOf(alice), bc.state.NonceOf(alice); got != 3*amountScale || nonce != 4 {
+		t.Fatalf("alice has %s at nonce %d, want 3.00 at nonce 4", got, nonce)
+	}
+
+	c, err := bc.state.campaign(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Raised != 7*amountScale || c.Withdrawn != 7*amountScale || c.Released != 2 || !bytes.Equal(c.Owner, bob) {
+		t.Fatalf("campaign = %+v, want 7.00 raised and paid out over 2 milestones", c)
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	// A donor who cannot pay makes the block invalid, whatever the campaign.
+	b := childBlock(bc, *typed(t, aliceWallet, 4, &DonatePayload{CampaignID: id}, 4*amountScale))
+	seal(t, bc, bc.Sealer, b)
+	if err := bc.AddBlock(b); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("AddBlock with an overspending donation: got %v, want %v", err, ErrInsufficientFunds)
+	}
+}
+
+func TestCampaignRefundsAfterDeadline(t *testing.T) {
+	bc := newFundedChain(t)
+	deadline := time.Now().Add(100 * time.Millisecond)
+	create := typed(t, bobWallet, 0, newCampaignPayload(deadline, 5*amountScale), 0)
+	id := create.ID()
+	donate := typed(t, aliceWallet, 0, &DonatePayload{CampaignID: id}, 2*amountScale)
+	early := typed(t, aliceWallet, 1, &RefundPayload{CampaignID: id}, 0)
+	createBlock(t, bc, create, donate, early)
+	checkReceipt(t, bc, early, ReceiptFailed, ErrNotRefundable)
+
+	time.Sleep(time.Until(deadline))
+	refund := typed(t, aliceWallet, 2, &RefundPayload{CampaignID: id}, 0)
+	again := typed(t, aliceWallet, 3, &RefundPayload{CampaignID: id}, 0)
+	late := typed(t, aliceWallet, 4, &DonatePayload{CampaignID: id}, amountScale)
+	expired := typed(t, bobWallet, 1, newCampaignPayload(deadline, amountScale), 0)
+	createBlock(t, bc, refund, again, late, expired)
+	checkReceipt(t, bc, refund, ReceiptSuccess, nil)
+	checkReceipt(t, bc, again, ReceiptFailed, ErrNothingToRefund)
+	checkReceipt(t, bc, late, ReceiptFailed, ErrCampaignDeadline)
+	checkReceipt(t, bc, expired, ReceiptFailed, ErrCampaignDeadline)
+	if got := bc.BalanceOf(alice); got != 10*amountScale {
+		t.Fatalf("alice has %s after the refund, want 10.00", got)
+	}
+	if c, _ := bc.Campaign(id); c.Raised != 0 || c.DonorCount() != 0 || bc.CampaignStatus(c) != CampaignFailed {
+		t.Fatalf("campaign holds %s from %d donors and is %s after the refund, want nothing and failed", c.Raised, c.DonorCount(), bc.CampaignStatus(c))
+	}
+	if _, err := bc.state.campaign(expired.ID()); !errors.Is(err, ErrUnknownCampaign) {
+		t.Fatalf("campaign created past its deadline: got %v, want %v", err, ErrUnknownCampaign)
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestCampaignsFollowReorg(t *testing.T) {
+	bc := newFundedChain(t)
+	create := typed(t, bobWallet, 0, newCampaignPayload(time.Now().Add(time.Hour), 5*amountScale), 0)
+	id := create.ID()
+	fork := createBlock(t, bc, create)
+	forkState := bc.state.Copy()
+
+	donate := typed(t, aliceWallet, 0, &DonatePayload{CampaignID: id}, 2*amountScale)
+	a := createBlock(t, bc, donate)
+
+	// A heavier branch without the donation steps the campaign back.
+	sideState := forkState.Copy()
+	side := fork
+	for i := 0; i < 2; i++ {
+		side = blockOn(t, bc, bc.Sealer, side, sideState)
+		if err := bc.AddBlock(side); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkHead(t, bc, side)
+	if c, err := bc.state.campaign(id); err != nil || c.Raised != 0 || len(c.contributions) != 0 {
+		t.Fatalf("campaign after the reorg = %+v, %v, want nothing raised", c, err)
+	}
+	if got := bc.BalanceOf(alice); got != 10*amountScale {
+		t.Fatalf("alice has %s after the reorg, want 10.00", got)
+	}
+
+	// Switching back applies the donation again.
+	mainState := forkState.Copy()
+	mainState.ApplyBlock(a)
+	head := a
+	for i := 0; i < 2; i++ {
+		head = blockOn(t, bc, bc.Sealer, head, mainState)
+		if err := bc.AddBlock(head); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkHead(t, bc, head)
+	if c, err := bc.state.campaign(id); err != nil || c.Raised != 2*amountScale {
+		t.Fatalf("campaign after switching back = %+v, %v, want 2.00 raised", c, err)
+	}
+}
+
+func TestAuthorityVoteTransaction(t *testing.T) {
+	bc := newFundedChain(t)
+	candidate := newAuthority(t)
+	vote := &AuthorityVotePayload{Candidate: wallet.PublicKeyToFixedBytes(candidate.PublicKey), Authorize: true}
+
+	if err := bc.AddTransaction(typed(t, aliceWallet, 0, vote, 0)); !errors.Is(err, ErrBadVote) {
+		t.Fatalf("vote of a stranger: got %v, want %v", err, ErrBadVote)
+	}
+	b := childBlock(bc, *typed(t, aliceWallet, 0, vote, 0))
+	seal(t, bc, bc.Sealer, b)
+	if err := bc.AddBlock(b); !errors.Is(err, ErrBadVote) {
+		t.Fatalf("block with the vote of a stranger: got %v, want %v", err, ErrBadVote)
+	}
+
+	// The only authority is a majority on its own.
+	tx := typed(t, bc.Sealer, 0, vote, 0)
+	createBlock(t, bc, tx)
+	checkReceipt(t, bc, tx, ReceiptSuccess, nil)
+	snap, err := bc.Snapshot(bc.LastBlock().Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snap.IsAuthorized(candidate.Address) {
+		t.Fatalf("candidate is not an authority after the vote")
+	}
+	if err := bc.AddTransaction(typed(t, bc.Sealer, 1, vote, 0)); !errors.Is(err, ErrBadVote) {
+		t.Fatalf("vote that changes nothing: got %v, want %v", err, ErrBadVote)
+	}
+
+	// Without consensus there are no authorities to vote.
+	plain := newTestChain(t)
+	b = childBlock(plain, *typed(t, aliceWallet, 0, vote, 0))
+	if err := plain.AddBlock(b); !errors.Is(err, ErrBadVote) {
+		t.Fatalf("vote on a chain without consensus: got %v, want %v", err, ErrBadVote)
+	}
+}
@@ -0,0 +1,261 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxClockDrift is how far into the future a block timestamp may be before
+// the block is rejected.
+const MaxClockDrift = 15 * time.Second
+
+// Rules a block can break. A *ValidationError wraps exactly one of these, so
+// callers can test for a rule with errors.Is.
+var (
+	ErrBadLink            = errors.New("previous hash does not match parent block")
+	ErrBadHeight          = errors.New("height does not follow parent block")
+	ErrBadMerkleRoot      = errors.New("merkle root does not match transactions")
+	ErrBadStateRoot       = errors.New("state root does not match the state after the block")
+	ErrBadReceiptsRoot    = errors.New("receipts root does not match the receipts of the block")
+	ErrBadSignature       = errors.New("invalid transaction signature")
+	ErrBadTimestamp       = errors.New("invalid block timestamp")
+	ErrBadSigner          = errors.New("block is not signed by an authority")
+	ErrUnsealedMint       = errors.New("mint outside a block sealed by an authority")
+	ErrBadVote            = errors.New("block carries an invalid authority vote")
+	ErrWrongChain         = errors.New("transaction is for another chain")
+	ErrTransactionVersion = errors.New("unsupported transaction version")
+	ErrBlockVersion       = errors.New("unsupported block version")
+)
+
+// ValidationError describes the first rule a block breaks.
+type ValidationError struct {
+	Height uint64
+	Hash   []byte
+	// Tx is the index of the offending transaction, or -1 when the rule is
+	// about the block itself.
+	Tx  int
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Tx >= 0 {
+		return fmt.Sprintf("block %d (%x): transaction %d: %v", e.Height, e.Hash, e.Tx, e.Err)
+	}
+	return fmt.Sprintf("block %d (%x): %v", e.Height, e.Hash, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func invalid(b *Block, tx int, err error) *ValidationError {
+	return invalidHeader(&b.Header, tx, err)
+}
+
+func invalidHeader(h *BlockHeader, tx int, err error) *ValidationError {
+	return &ValidationError{Height: h.Height, Hash: h.Hash(), Tx: tx, Err: err}
+}
+
+// ValidateHeader checks a header against its parent header without needing
+// either block body. parent must be nil for the genesis header. Headers must
+// be of the current BlockVersion, so that no block can fall back on the rules
+// of an older one. The PoA signer is only checked when the chain has a
+// Consensus engine.
+func (bc *Blockchain) ValidateHeader(h *BlockHeader, parent *BlockHeader) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.validateHeader(h, parent)
+}
+
+func (bc *Blockchain) validateHeader(h *BlockHeader, parent *BlockHeader) error {
+	if h.Version != BlockVersion {
+		return invalidHeader(h, -1, ErrBlockVersion)
+	}
+	if parent == nil {
+		if h.Height != 0 {
+			return invalidHeader(h, -1, ErrBadHeight)
+		}
+	} else {
+		if !bytes.Equal(h.PreviousHash, parent.Hash()) {
+			return invalidHeader(h, -1, ErrBadLink)
+		}
+		if h.Height != parent.Height+1 {
+			return invalidHeader(h, -1, ErrBadHeight)
+		}
+		if h.Timestamp <= parent.Timestamp {
+			return invalidHeader(h, -1, ErrBadTimestamp)
+		}
+	}
+	if h.Timestamp > uint64(time.Now().Add(MaxClockDrift).UnixNano()) {
+		return invalidHeader(h, -1, ErrBadTimestamp)
+	}
+
+	if bc.Consensus != nil && parent != nil {
+		snap, err := bc.snapshot(parent.Hash())
+		if err != nil {
+			return err
+		}
+		if err := bc.Consensus.VerifyHeader(h, snap); err != nil {
+			return invalidHeader(h, -1, fmt.Errorf("%w: %v", ErrBadSigner, err))
+		}
+		if err := bc.Consensus.VerifySchedule(h, parent, snap); err != nil {
+			rule := ErrBadSigner
+			if errors.Is(err, ErrTooEarly) {
+				rule = ErrBadTimestamp
+			}
+			return invalidHeader(h, -1, fmt.Errorf("%w: %v", rule, err))
+		}
+		if _, err := snap.Apply(h); err != nil {
+			return invalidHeader(h, -1, fmt.Errorf("%w: %v", ErrBadVote, err))
+		}
+	}
+	return nil
+}
+
+// ValidateBody checks that the transactions of b are the ones its header
+// commits to, that they are of the current TransactionVersion and meant for
+// this chain, that they keep to the rules of their kind and that every
+// transaction with a sender is signed by it. Authority votes are checked
+// against the PoA snapshot. Nonces are checked when the block is applied to
+// the state.
+func (bc *Blockchain) ValidateBody(b *Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.validateBody(b)
+}
+
+func (bc *Blockchain) validateBody(b *Block) error {
+	if !bytes.Equal(b.Header.MerkleRoot, b.MerkleTree().CalculateMerkleRoot()) {
+		return invalid(b, -1, ErrBadMerkleRoot)
+	}
+
+	for i := range b.Transactions {
+		tx := &b.Transactions[i]
+		if tx.Version != TransactionVersion {
+			return invalid(b, i, ErrTransactionVersion)
+		}
+		if tx.ChainID != bc.ChainID {
+			return invalid(b, i, ErrWrongChain)
+		}
+		if err := tx.CheckPayload(); err != nil {
+			return invalid(b, i, err)
+		}
+	}
+
+	// Funds may only be created by an authority, who is answerable for them
+	// as the proposer of the block. Without consensus there is nobody to sign.
+	if bc.Consensus == nil && b.Header.Height > 0 {
+		for i := range b.Transactions {
+			if b.Transactions[i].IsMint() {
+				return invalid(b, i, ErrUnsealedMint)
+			}
+		}
+	}
+
+	for i := range b.Transactions {
+		if err := b.Transactions[i].Verify(); err != nil {
+			if errors.Is(err, ErrBadSignature) {
+				return invalid(b, i, err)
+			}
+			return invalid(b, i, fmt.Errorf("%w: %v", ErrBadSignature, err))
+		}
+	}
+	return bc.checkVotes(b)
+}
+
+// checkVotes checks the authority-vote transactions of b against the PoA
+// snapshot at its parent. Without a consensus engine there are no
+// authorities to vote.
+func (bc *Blockchain) checkVotes(b *Block) error {
+	for i := range b.Transactions {
+		if b.Transactions[i].Kind != TxAuthorityVote {
+			continue
+		}
+		if bc.Consensus == nil {
+			return invalid(b, i, fmt.Errorf("%w: chain has no authorities", ErrBadVote))
+		}
+		snap, err := bc.snapshot(b.Header.PreviousHash)
+		if err != nil {
+			return err
+		}
+		_, err = snap.ApplyBlock(b)
+		return err
+	}
+	return nil
+}
+
+// checkStateRoot checks that b commits to state, the state after applying
+// it.
+func checkStateRoot(b *Block, state *State) error {
+	if !bytes.Equal(b.Header.StateRoot, state.Root()) {
+		return invalid(b, -1, ErrBadStateRoot)
+	}
+	return nil
+}
+
+// checkReceiptsRoot checks that b commits to receipts, the receipts of
+// executing it.
+func checkReceiptsRoot(b *Block, receipts []*Receipt) error {
+	if !bytes.Equal(b.Header.ReceiptsRoot, ReceiptsRoot(receipts)) {
+		return invalid(b, -1, ErrBadReceiptsRoot)
+	}
+	return nil
+}
+
+// executeChecked executes b on state and checks the state and receipts roots
+// it commits to. state is left untouched if b does not apply, but not if one
+// of the roots is wrong.
+func executeChecked(b *Block, state *State) ([]*Receipt, error) {
+	receipts, err := state.ExecuteBlock(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStateRoot(b, state); err != nil {
+		return nil, err
+	}
+	if err := checkReceiptsRoot(b, receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// ValidateBlock checks b against its parent, header first and then body.
+// parent must be nil for the genesis block.
+func (bc *Blockchain) ValidateBlock(b *Block, parent *Block) error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	return bc.validateBlock(b, parent)
+}
+
+func (bc *Blockchain) validateBlock(b *Block, parent *Block) error {
+	var parentHeader *BlockHeader
+	if parent != nil {
+		parentHeader = &parent.Header
+	}
+	if err := bc.validateHeader(&b.Header, parentHeader); err != nil {
+		return err
+	}
+	return bc.validateBody(b)
+}
+
+// Validate walks the whole chain from genesis, replaying balances as it
+// goes and checking state and receipts roots against them, and returns the
+// first rule that is broken, or nil if the chain is valid.
+func (bc *Blockchain) Validate() error {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+	var parent *Block
+	state := NewState()
+	for _, b := range bc.Chain {
+		if err := bc.validateBlock(b, parent); err != nil {
+			return err
+		}
+		if _, err := executeChecked(b, state); err != nil {
+			return err
+		}
+		parent = b
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Roshan310/DaanVeer/wallet"
+)
+
+// testChainID is the chain ID of the chains built by tests.
+const testChainID = "daanveer-test"
+
+// newTestChain returns an empty in-memory chain holding only its genesis
+// block.
+func newTestChain(t *testing.T) *Blockchain {
+	t.Helper()
+	bc, err := NewBlockchain(NewMemoryStore(), &Genesis{ChainID: testChainID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+// newAuthority returns a wallet with its address filled in, as PoA expects
+// of a sealer.
+func newAuthority(t *testing.T) *wallet.Wallet {
+	t.Helper()
+	w := &wallet.Wallet{}
+	if err := w.GenerateKeyPair(); err != nil {
+		t.Fatal(err)
+	}
+	w.Address = wallet.GenerateAddress(w.PublicKey)
+	return w
+}
+
+// keys returns the public keys of ws.
+func keys(ws ...*wallet.Wallet) []*ecdsa.PublicKey {
+	var keys []*ecdsa.PublicKey
+	for _, w := range ws {
+		keys = append(keys, w.PublicKey)
+	}
+	return keys
+}
+
+// newTestPoA returns a PoA engine of ws without a block period, so tests can
+// seal blocks back to back.
+func newTestPoA(ws ...*wallet.Wallet) *PoA {
+	poa := NewPoA(keys(ws...))
+	poa.Period, poa.OutOfTurnDelay = 0, 0
+	return poa
+}
+
+// seal signs b, a child of a block of bc, with the authority wallet w.
+func seal(t *testing.T, bc *Blockchain, w *wallet.Wallet, b *Block) {
+	t.Helper()
+	snap, err := bc.Snapshot(b.Header.PreviousHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Consensus.SignBlock(w, b, snap); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sealHeader signs h with w as it is, without any of the checks and
+// changes SignBlock makes.
+func sealHeader(t *testing.T, w *wallet.Wallet, h *BlockHeader) {
+	t.Helper()
+	signature, err := wallet.Sign(w.PrivateKey, h.SealHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Signature = signature.Bytes()
+}
+
+// withAuthorities returns a setup that makes ws the authorities of a chain.
+func withAuthorities(ws ...*wallet.Wallet) func(bc *Blockchain) {
+	return func(bc *Blockchain) { bc.Consensus = newTestPoA(ws...) }
+}
+
+// childBlock returns a block on top of the head of bc holding txs, with its
+// Merkle root filled in and its state and receipts roots set to the outcome
+// of txs, as far as they apply.
+func childBlock(bc *Blockchain, txs ...Transactions) *Block {
+	b := NewBlock(bc.LastBlock().Hash(), txs)
+	b.Header.Height = bc.LastBlock().Header.Height + 1
+	state := bc.state.Copy()
+	receipts, _ := state.ExecuteBlock(b)
+	b.Header.StateRoot = state.Root()
+	b.Header.ReceiptsRoot = ReceiptsRoot(receipts)
+	return b
+}
+
+func TestAddBlockRejectsInvalidBlocks(t *testing.T) {
+	authority, other, stranger := newAuthority(t), newAuthority(t), newAuthority(t)
+	transfer := *NewTransaction(testChainID, 0, []byte("alice"), []byte("bob"), 1)
+	tests := []struct {
+		name  string
+		setup func(bc *Blockchain)
+		block func(bc *Blockchain) *Block
+		tx    int
+		want  error
+	}{
+		{
+			"older block version",
+			nil,
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc)
+				b.Header.Version--
+				return b
+			},
+			-1, ErrBlockVersion,
+		},
+		{
+			"height does not follow parent",
+			nil,
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc)
+				b.Header.Height++
+				return b
+			},
+			-1, ErrBadHeight,
+		},
+		{
+			"merkle root mismatch",
+			nil,
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc, transfer)
+				b.Transactions[0].Value++
+				return b
+			},
+			-1, ErrBadMerkleRoot,
+		},
+		{
+			"merkle root of the legacy scheme",
+			nil,
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc, transfer)
+				b.Header.MerkleRoot = NewMerkleTreeWithScheme(b.Transactions, MerkleSchemeLegacy).CalculateMerkleRoot()
+				return b
+			},
+			-1, ErrBadMerkleRoot,
+		},
+		{
+			"state root of the parent",
+			withAuthorities(authority),
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc, *NewTransaction(testChainID, 0, nil, []byte("bob"), 1))
+				b.Header.StateRoot = bc.state.Root()
+				seal(t, bc, authority, b)
+				return b
+			},
+			-1, ErrBadStateRoot,
+		},
+		{
+			"timestamp before parent",
+			nil,
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc)
+				b.Header.Timestamp = bc.LastBlock().Header.Timestamp
+				return b
+			},
+			-1, ErrBadTimestamp,
+		},
+		{
+			"timestamp in the future",
+			nil,
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc)
+				b.Header.Timestamp = uint64(time.Now().Add(2 * MaxClockDrift).UnixNano())
+				return b
+			},
+			-1, ErrBadTimestamp,
+		},
+		{
+			"unsigned transaction",
+			nil,
+			func(bc *Blockchain) *Block { return childBlock(bc, transfer, transfer) },
+			0, ErrBadSignature,
+		},
+		{
+			"value changed after signing",
+			nil,
+			func(bc *Blockchain) *Block {
+				tx := *signedTransfer(t, aliceWallet, 0, bob, 1)
+				tx.Value++
+				return childBlock(bc, *signedTransfer(t, bobWallet, 0, alice, 1), tx)
+			},
+			1, ErrBadSignature,
+		},
+		{
+			"signed with the key of another sender",
+			nil,
+			func(bc *Blockchain) *Block {
+				tx := *signedTransfer(t, aliceWallet, 0, bob, 1)
+				tx.SenderHash = bob
+				return childBlock(bc, tx)
+			},
+			0, ErrBadSignature,
+		},
+		{
+			"transaction for another chain",
+			nil,
+			func(bc *Blockchain) *Block {
+				return childBlock(bc, transfer, *NewTransaction("other", 0, []byte("alice"), []byte("bob"), 1))
+			},
+			1, ErrWrongChain,
+		},
+		{
+			"transaction of an older version",
+			nil,
+			func(bc *Blockchain) *Block {
+				old := transfer
+				old.Version = TransactionVersion - 1
+				return childBlock(bc, old)
+			},
+			0, ErrTransactionVersion,
+		},
+		{
+			"mint without consensus",
+			nil,
+			func(bc *Blockchain) *Block {
+				return childBlock(bc, *NewTransaction(testChainID, 0, nil, []byte("bob"), 1))
+			},
+			0, ErrUnsealedMint,
+		},
+		{
+			"signed by a stranger",
+			withAuthorities(authority),
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc)
+				poa := newTestPoA(stranger)
+				poa.SignBlock(stranger, b, poa.Genesis(&bc.LastBlock().Header))
+				return b
+			},
+			-1, ErrBadSigner,
+		},
+		{
+			"proposer changed after signing",
+			withAuthorities(authority, other),
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc)
+				seal(t, bc, authority, b)
+				b.Header.Proposer = other.Address
+				return b
+			},
+			-1, ErrBadSigner,
+		},
+		{
+			"timestamp changed after signing",
+			withAuthorities(authority),
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc)
+				seal(t, bc, authority, b)
+				b.Header.Timestamp++
+				return b
+			},
+			-1, ErrBadSigner,
+		},
+		{
+			"vote for an authority",
+			withAuthorities(authority),
+			func(bc *Blockchain) *Block {
+				b := childBlock(bc)
+				b.Header.Proposer = authority.Address
+				b.Header.VoteCandidate = wallet.PublicKeyToFixedBytes(authority.PublicKey)
+				b.Header.VoteAuthorize = true
+				sealHeader(t, authority, &b.Header)
+				return b
+			},
+			-1, ErrBadVote,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bc := newTestChain(t)
+			if tt.setup != nil {
+				tt.setup(bc)
+			}
+			b := tt.block(bc)
+			err := bc.AddBlock(b)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("AddBlock: got %v, want %v", err, tt.want)
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("AddBlock: got %T, want *ValidationError", err)
+			}
+			if verr.Height != b.Header.Height || !bytes.Equal(verr.Hash, b.Hash()) || verr.Tx != tt.tx {
+				t.Errorf("got block %d (%x) transaction %d, want block %d (%x) transaction %d",
+					verr.Height, verr.Hash, verr.Tx, b.Header.Height, b.Hash(), tt.tx)
+			}
+			if len(bc.Chain) != 1 {
+				t.Fatalf("chain has %d blocks, want 1", len(bc.Chain))
+			}
+		})
+	}
+}
+
+func TestAddBlockAcceptsSignedBlock(t *testing.T) {
+	authority := newAuthority(t)
+	bc := newTestChain(t)
+	bc.Consensus = newTestPoA(authority)
+	b := childBlock(bc, *NewTransaction(testChainID, 0, nil, []byte("alice"), 1))
+	seal(t, bc, authority, b)
+	if err := bc.AddBlock(b); err != nil {
+		t.Fatalf("AddBlock: %v", err)
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
+
+func TestCreateBlockSealsWithSealer(t *testing.T) {
+	authority := newAuthority(t)
+	bc := newTestChain(t)
+	bc.Consensus = newTestPoA(authority)
+	if _, err := bc.CreateBlock(bc.LastBlock().Hash()); !errors.Is(err, ErrNoSealer) {
+		t.Fatalf("CreateBlock without sealer: got %v, want %v", err, ErrNoSealer)
+	}
+
+	bc.Sealer = newAuthority(t)
+	if _, err := bc.CreateBlock(bc.LastBlock().Hash()); !errors.Is(err, ErrUnauthorizedSigner) {
+		t.Fatalf("CreateBlock with a stranger: got %v, want %v", err, ErrUnauthorizedSigner)
+	}
+
+	bc.Sealer = authority
+	b, err := bc.CreateBlock(bc.LastBlock().Hash())
+	if err != nil {
+		t.Fatalf("CreateBlock: %v", err)
+	}
+	if b.Header.Proposer != authority.Address {
+		t.Errorf("proposer = %q, want %q", b.Header.Proposer, authority.Address)
+	}
+	if err := bc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
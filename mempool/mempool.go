@@ -0,0 +1,402 @@
+// Package mempool holds transactions that have been submitted but not yet
+// included in a block.
+//
+// The pool does not know the concrete transaction type of the chain. It works
+// on anything that implements Tx and checks balances through State, so the
+// blockchain package can use it without an import cycle.
+package mempool
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDuplicate         = errors.New("transaction already in pool")
+	ErrNonceTaken        = errors.New("sender already has a pooled transaction with this nonce")
+	ErrNonceTooLow       = errors.New("nonce has already been used")
+	ErrNonceGap          = errors.New("nonce is ahead of the sender's next nonce")
+	ErrInsufficientFunds = errors.New("insufficient funds for pooled transactions")
+	ErrPoolFull          = errors.New("transaction pool is full")
+	ErrTooLarge          = errors.New("transaction is larger than the pool")
+)
+
+// Tx is a transaction as far as the pool is concerned.
+type Tx interface {
+	// ID uniquely identifies the transaction.
+	ID() string
+	// Sender is the account the cost is debited from. Transactions with an
+	// empty sender are not checked against any balance or nonce.
+	Sender() string
+	// Nonce orders the transactions of one sender. The pooled transactions
+	// of a sender always have consecutive nonces, starting at the sender's
+	// nonce in State.
+	Nonce() uint64
+	// Cost is what the transaction debits from the sender, in the smallest
+	// currency unit.
+	Cost() uint64
+	// Size is the encoded size of the transaction in bytes.
+	Size() int
+	// Verify checks the transaction on its own, e.g. its signature.
+	Verify() error
+}
+
+// State gives the pool the balances and nonces transactions are checked
+// against.
+type State interface {
+	Balance(sender string) uint64
+	// Nonce is the nonce of the sender's next transaction.
+	Nonce(sender string) uint64
+}
+
+// Config limits the pool.
+type Config struct {
+	// MaxCount is the maximum number of pooled transactions.
+	MaxCount int
+	// MaxBytes is the maximum total size of pooled transactions.
+	MaxBytes int
+	// TTL is how long a transaction may wait in the pool before it expires.
+	TTL time.Duration
+}
+
+var DefaultConfig = Config{
+	MaxCount: 10000,
+	MaxBytes: 32 << 20,
+	TTL:      3 * time.Hour,
+}
+
+type entry struct {
+	tx    Tx
+	added time.Time
+	seq   uint64
+}
+
+// Mempool is a bounded pool of transactions, queued per sender in nonce
+// order. It is safe for concurrent use.
+type Mempool struct {
+	mu     sync.Mutex
+	config Config
+	state  State
+	now    func() time.Time
+
+	byID     map[string]*entry
+	bySender map[string][]*entry
+	bytes    int
+	seq      uint64
+}
+
+func New(config Config, state State) *Mempool {
+	return &Mempool{
+		config:   config,
+		state:    state,
+		now:      time.Now,
+		byID:     make(map[string]*entry),
+		bySender: make(map[string][]*entry),
+	}
+}
+
+// Len returns the number of pooled transactions.
+func (mp *Mempool) Len() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return len(mp.byID)
+}
+
+// Bytes returns the total size of pooled transactions.
+func (mp *Mempool) Bytes() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.bytes
+}
+
+// Has reports whether a transaction with the given ID is pooled.
+func (mp *Mempool) Has(id string) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	_, ok := mp.byID[id]
+	return ok
+}
+
+// Get returns the pooled transaction with the given ID.
+func (mp *Mempool) Get(id string) (Tx, bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	e, ok := mp.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return e.tx, true
+}
+
+// Add admits tx into the pool. The transaction must verify, must not already
+// be pooled, must carry the sender's next unused nonce and the sender must be
+// able to pay for it on top of everything they already have pooled. If the
+// pool is full, transactions are evicted to make room, see evict.
+func (mp *Mempool) Add(tx Tx) error {
+	if err := tx.Verify(); err != nil {
+		return err
+	}
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if _, ok := mp.byID[tx.ID()]; ok {
+		return ErrDuplicate
+	}
+	if tx.Size() > mp.config.MaxBytes {
+		return ErrTooLarge
+	}
+
+	sender := tx.Sender()
+	queue := mp.bySender[sender]
+	for _, e := range queue {
+		if e.tx.Nonce() == tx.Nonce() {
+			return ErrNonceTaken
+		}
+	}
+	if sender != "" {
+		next := mp.state.Nonce(sender)
+		if tx.Nonce() < next {
+			return fmt.Errorf("%w: %s is at nonce %d", ErrNonceTooLow, sender, next)
+		}
+		if tx.Nonce() > next+uint64(len(queue)) {
+			return fmt.Errorf("%w: %s expects nonce %d", ErrNonceGap, sender, next+uint64(len(queue)))
+		}
+
+		pending := tx.Cost()
+		for _, e := range queue {
+			var ok bool
+			if pending, ok = addCost(pending, e.tx.Cost()); !ok {
+				return fmt.Errorf("%w: %s's pooled transactions cost more than %d", ErrInsufficientFunds, sender, uint64(math.MaxUint64))
+			}
+		}
+		if balance := mp.state.Balance(sender); pending > balance {
+			return fmt.Errorf("%w: %s needs %d, has %d", ErrInsufficientFunds, sender, pending, balance)
+		}
+	}
+
+	for len(mp.byID)+1 > mp.config.MaxCount || mp.bytes+tx.Size() > mp.config.MaxBytes {
+		if !mp.evict(tx) {
+			return ErrPoolFull
+		}
+	}
+
+	mp.seq++
+	e := &entry{tx: tx, added: mp.now(), seq: mp.seq}
+	mp.byID[tx.ID()] = e
+	queue = append(mp.bySender[sender], e)
+	sort.Slice(queue, func(i, j int) bool { return queue[i].tx.Nonce() < queue[j].tx.Nonce() })
+	mp.bySender[sender] = queue
+	mp.bytes += tx.Size()
+	return nil
+}
+
+// addCost returns a+b and reports false if the sum overflows, in which case
+// no balance can pay for it.
+func addCost(a, b uint64) (uint64, bool) {
+	if a > math.MaxUint64-b {
+		return 0, false
+	}
+	return a + b, true
+}
+
+// evict makes room for incoming by dropping the highest-nonce transaction of
+// the sender with the most pooled transactions, so a single sender flooding
+// the pool only ever pushes out its own transactions and no sender is left
+// with a gap in its nonces. It reports false if nothing can be evicted for
+// incoming, which is the case when incoming's sender is the one to evict from
+// and incoming would itself be its last transaction.
+func (mp *Mempool) evict(incoming Tx) bool {
+	var victim string
+	for sender, queue := range mp.bySender {
+		if len(queue) > len(mp.bySender[victim]) || (len(queue) == len(mp.bySender[victim]) && sender < victim) {
+			victim = sender
+		}
+	}
+	queue := mp.bySender[victim]
+	if len(queue) == 0 {
+		return false
+	}
+	last := queue[len(queue)-1]
+	if victim == incoming.Sender() && incoming.Nonce() > last.tx.Nonce() {
+		return false
+	}
+	mp.removeLocked(last.tx.ID())
+	return true
+}
+
+// NextNonce returns the nonce the sender's next transaction must carry to be
+// admitted: the sender's nonce in State plus everything they have pooled.
+func (mp *Mempool) NextNonce(sender string) uint64 {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.state.Nonce(sender) + uint64(len(mp.bySender[sender]))
+}
+
+// Remove drops the transactions with the given IDs, typically because they
+// have been included in a block.
+func (mp *Mempool) Remove(ids ...string) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	for _, id := range ids {
+		mp.removeLocked(id)
+	}
+}
+
+func (mp *Mempool) removeLocked(id string) {
+	e, ok := mp.byID[id]
+	if !ok {
+		return
+	}
+	delete(mp.byID, id)
+	mp.bytes -= e.tx.Size()
+
+	sender := e.tx.Sender()
+	queue := mp.bySender[sender]
+	for i := range queue {
+		if queue[i] == e {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(mp.bySender, sender)
+	} else {
+		mp.bySender[sender] = queue
+	}
+}
+
+// Prune drops every transaction that has been pooled for longer than the
+// TTL, together with the later transactions of the same sender, and returns
+// what it dropped.
+func (mp *Mempool) Prune(now time.Time) []Tx {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var dropped []Tx
+	for _, queue := range mp.bySender {
+		for i, e := range queue {
+			if now.Sub(e.added) <= mp.config.TTL {
+				continue
+			}
+			for _, stale := range queue[i:] {
+				dropped = append(dropped, stale.tx)
+			}
+			break
+		}
+	}
+	for _, tx := range dropped {
+		mp.removeLocked(tx.ID())
+	}
+	return dropped
+}
+
+// Revalidate re-checks every sender's pooled transactions against the
+// current state, e.g. after a new block. It drops the transactions whose
+// nonce has been used in the meantime and the ones the sender can no longer
+// pay for, along with everything queued behind them.
+func (mp *Mempool) Revalidate() []Tx {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var dropped []Tx
+	for sender, queue := range mp.bySender {
+		if sender == "" {
+			continue
+		}
+		balance := mp.state.Balance(sender)
+		next := mp.state.Nonce(sender)
+		var pending uint64
+		for i, e := range queue {
+			if e.tx.Nonce() < next {
+				dropped = append(dropped, e.tx)
+				continue
+			}
+			var ok bool
+			pending, ok = addCost(pending, e.tx.Cost())
+			if !ok || e.tx.Nonce() > next || pending > balance {
+				for _, unusable := range queue[i:] {
+					dropped = append(dropped, unusable.tx)
+				}
+				break
+			}
+			next++
+		}
+	}
+	for _, tx := range dropped {
+		mp.removeLocked(tx.ID())
+	}
+	return dropped
+}
+
+// Select picks transactions for a block, at most maxCount of them (no limit
+// if maxCount is 0) with a total size of at most maxBytes. Each sender's
+// transactions come out in nonce order; across senders the transaction that
+// has waited longest goes first. A sender whose next transaction does not fit
+// is skipped entirely, since its later transactions depend on it.
+func (mp *Mempool) Select(maxBytes int, maxCount int) []Tx {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	heads := make(senderHeads, 0, len(mp.bySender))
+	for _, queue := range mp.bySender {
+		heads = append(heads, &senderHead{queue: queue})
+	}
+	heap.Init(&heads)
+
+	var selected []Tx
+	size := 0
+	for heads.Len() > 0 && (maxCount == 0 || len(selected) < maxCount) {
+		head := heads[0]
+		next := head.queue[head.next]
+		if size+next.tx.Size() > maxBytes {
+			heap.Pop(&heads)
+			continue
+		}
+		selected = append(selected, next.tx)
+		size += next.tx.Size()
+		if head.next++; head.next < len(head.queue) {
+			heap.Fix(&heads, 0)
+		} else {
+			heap.Pop(&heads)
+		}
+	}
+	return selected
+}
+
+// senderHead is the position of Select in the queue of one sender.
+type senderHead struct {
+	queue []*entry
+	next  int
+}
+
+// senderHeads is a heap of the senders Select still picks from, ordered by
+// how long their next transaction has waited.
+type senderHeads []*senderHead
+
+func (h senderHeads) Len() int { return len(h) }
+func (h senderHeads) Less(i, j int) bool {
+	return h[i].queue[h[i].next].seq < h[j].queue[h[j].next].seq
+}
+func (h senderHeads) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *senderHeads) Push(x any)   { *h = append(*h, x.(*senderHead)) }
+func (h *senderHeads) Pop() any {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+// Pending returns every pooled transaction in the order Select would pick
+// them with no limits.
+func (mp *Mempool) Pending() []Tx {
+	mp.mu.Lock()
+	bytes := mp.bytes
+	mp.mu.Unlock()
+	return mp.Select(bytes, 0)
+}
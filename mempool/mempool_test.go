@@ -0,0 +1,211 @@
+package mempool
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type testTx struct {
+	id     string
+	sender string
+	nonce  uint64
+	cost   uint64
+}
+
+func (tx *testTx) ID() string     { return tx.id }
+func (tx *testTx) Sender() string { return tx.sender }
+func (tx *testTx) Nonce() uint64  { return tx.nonce }
+func (tx *testTx) Cost() uint64   { return tx.cost }
+func (tx *testTx) Size() int      { return 100 }
+func (tx *testTx) Verify() error  { return nil }
+
+type testState struct {
+	balances map[string]uint64
+	nonces   map[string]uint64
+}
+
+func (s *testState) Balance(sender string) uint64 { return s.balances[sender] }
+func (s *testState) Nonce(sender string) uint64   { return s.nonces[sender] }
+
+// newTestState returns a state in which alice, bob and carol hold 1000 each
+// and have not made any transactions yet.
+func newTestState() *testState {
+	return &testState{
+		balances: map[string]uint64{"alice": 1000, "bob": 1000, "carol": 1000},
+		nonces:   map[string]uint64{},
+	}
+}
+
+// add puts txs into mp and fails the test if any of them is rejected.
+func add(t *testing.T, mp *Mempool, txs ...*testTx) {
+	t.Helper()
+	for _, tx := range txs {
+		if err := mp.Add(tx); err != nil {
+			t.Fatalf("Add(%s): %v", tx.id, err)
+		}
+	}
+}
+
+// ids returns the IDs of txs in order.
+func ids(txs []Tx) []string {
+	ids := []string{}
+	for _, tx := range txs {
+		ids = append(ids, tx.ID())
+	}
+	return ids
+}
+
+func TestAddRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   *testTx
+		want error
+	}{
+		{"same transaction again", &testTx{id: "a0", sender: "alice", nonce: 5, cost: 1}, ErrDuplicate},
+		{"nonce already pooled", &testTx{id: "a0'", sender: "alice", nonce: 5, cost: 1}, ErrNonceTaken},
+		{"more than the balance with what is pooled", &testTx{id: "a1", sender: "alice", nonce: 6, cost: 1000}, ErrInsufficientFunds},
+		{"pooled cost overflows", &testTx{id: "a1", sender: "alice", nonce: 6, cost: math.MaxUint64}, ErrInsufficientFunds},
+		{"unknown sender", &testTx{id: "d0", sender: "dave", nonce: 0, cost: 1}, ErrInsufficientFunds},
+		{"nonce used before", &testTx{id: "a-1", sender: "alice", nonce: 4, cost: 1}, ErrNonceTooLow},
+		{"nonce gap", &testTx{id: "a2", sender: "alice", nonce: 7, cost: 1}, ErrNonceGap},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newTestState()
+			state.nonces["alice"] = 5
+			mp := New(DefaultConfig, state)
+			add(t, mp, &testTx{id: "a0", sender: "alice", nonce: 5, cost: 1})
+			if err := mp.Add(tt.tx); !errors.Is(err, tt.want) {
+				t.Fatalf("Add: got %v, want %v", err, tt.want)
+			}
+			if mp.Len() != 1 {
+				t.Fatalf("pool holds %d transactions, want 1", mp.Len())
+			}
+		})
+	}
+}
+
+func TestAddEvictsAtCapacity(t *testing.T) {
+	mp := New(Config{MaxCount: 3, MaxBytes: 1000, TTL: time.Hour}, newTestState())
+	add(t, mp,
+		&testTx{id: "a0", sender: "alice", nonce: 0, cost: 1},
+		&testTx{id: "a1", sender: "alice", nonce: 1, cost: 1},
+		&testTx{id: "a2", sender: "alice", nonce: 2, cost: 1},
+	)
+
+	// A sender filling the pool only ever pushes out its own transactions,
+	// and never the one its new transaction would follow.
+	if err := mp.Add(&testTx{id: "a3", sender: "alice", nonce: 3, cost: 1}); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("Add(a3): got %v, want %v", err, ErrPoolFull)
+	}
+	add(t, mp, &testTx{id: "b0", sender: "bob", nonce: 0, cost: 1})
+	if mp.Has("a2") {
+		t.Fatal("a2 is still pooled after b0 was added to a full pool")
+	}
+
+	add(t, mp, &testTx{id: "c0", sender: "carol", nonce: 0, cost: 1})
+	if got, want := ids(mp.Pending()), []string{"a0", "b0", "c0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pool holds %v, want %v", got, want)
+	}
+
+	// With every sender holding as many transactions, the first one by name
+	// loses its last.
+	add(t, mp, &testTx{id: "b1", sender: "bob", nonce: 1, cost: 1})
+	if got, want := ids(mp.Pending()), []string{"b0", "c0", "b1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pool holds %v, want %v", got, want)
+	}
+}
+
+func TestAddRejectsTooLarge(t *testing.T) {
+	mp := New(Config{MaxCount: 10, MaxBytes: 99, TTL: time.Hour}, newTestState())
+	if err := mp.Add(&testTx{id: "a0", sender: "alice", nonce: 0, cost: 1}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Add: got %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func TestPruneDropsExpired(t *testing.T) {
+	mp := New(Config{MaxCount: 10, MaxBytes: 1000, TTL: time.Hour}, newTestState())
+	add(t, mp,
+		&testTx{id: "a0", sender: "alice", nonce: 0, cost: 1},
+		&testTx{id: "a1", sender: "alice", nonce: 1, cost: 1},
+		&testTx{id: "b0", sender: "bob", nonce: 0, cost: 1},
+	)
+	if dropped := mp.Prune(time.Now().Add(30 * time.Minute)); len(dropped) != 0 {
+		t.Fatalf("Prune before the TTL dropped %v", ids(dropped))
+	}
+	dropped := mp.Prune(time.Now().Add(2 * time.Hour))
+	if len(dropped) != 3 || mp.Len() != 0 {
+		t.Fatalf("Prune after the TTL dropped %v and left %d transactions, want all 3 dropped", ids(dropped), mp.Len())
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int
+		maxCount int
+		want     []string
+	}{
+		{"no limits", 1000, 0, []string{"a0", "b0", "a1", "c0"}},
+		{"count limit", 1000, 2, []string{"a0", "b0"}},
+		{"byte limit", 300, 0, []string{"a0", "b0", "a1"}},
+		{"byte limit smaller than one transaction", 99, 0, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mp := New(DefaultConfig, newTestState())
+			add(t, mp,
+				&testTx{id: "a0", sender: "alice", nonce: 0, cost: 1},
+				&testTx{id: "b0", sender: "bob", nonce: 0, cost: 1},
+				&testTx{id: "a1", sender: "alice", nonce: 1, cost: 1},
+				&testTx{id: "c0", sender: "carol", nonce: 0, cost: 1},
+			)
+			if got := ids(mp.Select(tt.maxBytes, tt.maxCount)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Select = %v, want %v", got, tt.want)
+			}
+			if mp.Len() != 4 {
+				t.Fatalf("pool holds %d transactions after Select, want 4", mp.Len())
+			}
+		})
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	state := newTestState()
+	state.balances["alice"] = 3
+	mp := New(DefaultConfig, state)
+	add(t, mp,
+		&testTx{id: "a0", sender: "alice", nonce: 0, cost: 1},
+		&testTx{id: "a1", sender: "alice", nonce: 1, cost: 1},
+		&testTx{id: "a2", sender: "alice", nonce: 2, cost: 1},
+		&testTx{id: "b0", sender: "bob", nonce: 0, cost: 1},
+		&testTx{id: "b1", sender: "bob", nonce: 1, cost: 1},
+	)
+
+	// A block spends a0 along with another transaction of alice, and uses
+	// bob's nonce 0 for a transaction that is not pooled.
+	state.nonces["alice"], state.balances["alice"] = 1, 1
+	state.nonces["bob"] = 1
+	mp.Remove("a0")
+	if got, want := ids(mp.Revalidate()), []string{"a2", "b0"}; !sameIDs(got, want) {
+		t.Fatalf("Revalidate dropped %v, want %v", got, want)
+	}
+	if got, want := ids(mp.Pending()), []string{"a1", "b1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pool holds %v, want %v", got, want)
+	}
+	if next := mp.NextNonce("alice"); next != 2 {
+		t.Fatalf("NextNonce = %d, want 2", next)
+	}
+}
+
+// sameIDs reports whether a and b hold the same IDs in any order.
+func sameIDs(a, b []string) bool {
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,83 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+// SignatureLength is the length of an encoded Signature.
+const SignatureLength = 64
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature encoding")
+	ErrHighS            = errors.New("signature s value is not in the lower half of the curve order")
+)
+
+// Signature is an ECDSA P-256 signature encoded as r and s, each left-padded
+// to 32 bytes.
+//
+// For every signature (r, s) the signature (r, N-s) is valid as well, so
+// anyone could change the bytes of a signed object without the signer's key.
+// To rule that out only the low-S form, s <= N/2, is accepted.
+type Signature [SignatureLength]byte
+
+var halfOrder = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+// Sign signs hash with key and returns the signature in low-S form.
+func Sign(key *ecdsa.PrivateKey, hash []byte) (Signature, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash)
+	if err != nil {
+		return Signature{}, err
+	}
+	if s.Cmp(halfOrder) > 0 {
+		s.Sub(key.Curve.Params().N, s)
+	}
+	var sig Signature
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// ParseSignature reads a signature written by Signature.Bytes. It rejects
+// anything that is not exactly SignatureLength bytes, values of r or s that
+// are out of range and signatures that are not in low-S form.
+func ParseSignature(b []byte) (Signature, error) {
+	var sig Signature
+	if len(b) != SignatureLength {
+		return sig, ErrInvalidSignature
+	}
+	copy(sig[:], b)
+
+	n := elliptic.P256().Params().N
+	r, s := sig.R(), sig.S()
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 || s.Cmp(n) >= 0 {
+		return Signature{}, ErrInvalidSignature
+	}
+	if s.Cmp(halfOrder) > 0 {
+		return Signature{}, ErrHighS
+	}
+	return sig, nil
+}
+
+func (sig Signature) R() *big.Int {
+	return new(big.Int).SetBytes(sig[:32])
+}
+
+func (sig Signature) S() *big.Int {
+	return new(big.Int).SetBytes(sig[32:])
+}
+
+func (sig Signature) Bytes() []byte {
+	return append([]byte(nil), sig[:]...)
+}
+
+// Verify reports whether sig is a low-S signature of hash by key.
+func (sig Signature) Verify(key *ecdsa.PublicKey, hash []byte) bool {
+	if sig.S().Cmp(halfOrder) > 0 {
+		return false
+	}
+	return ecdsa.Verify(key, hash, sig.R(), sig.S())
+}
@@ -0,0 +1,102 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func newTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// encode writes r and s the way Signature.Bytes does, without any checks.
+func encode(r, s *big.Int) []byte {
+	b := make([]byte, SignatureLength)
+	r.FillBytes(b[:32])
+	s.FillBytes(b[32:])
+	return b
+}
+
+func TestSignProducesLowS(t *testing.T) {
+	key := newTestKey(t)
+	hash := sha256.Sum256([]byte("message"))
+	// About half of all raw signatures have a high s, so a missing
+	// normalisation shows up long before the last iteration.
+	for i := 0; i < 64; i++ {
+		sig, err := Sign(key, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig.S().Cmp(halfOrder) > 0 {
+			t.Fatalf("Sign returned high s %x", sig.S())
+		}
+		if _, err := ParseSignature(sig.Bytes()); err != nil {
+			t.Fatalf("ParseSignature(Sign): %v", err)
+		}
+		if !sig.Verify(&key.PublicKey, hash[:]) {
+			t.Fatal("Verify rejects a signature made by Sign")
+		}
+	}
+}
+
+func TestParseSignatureRejects(t *testing.T) {
+	key := newTestKey(t)
+	hash := sha256.Sum256([]byte("message"))
+	sig, err := Sign(key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := elliptic.P256().Params().N
+	highS := new(big.Int).Sub(n, sig.S())
+
+	tests := []struct {
+		name string
+		b    []byte
+		want error
+	}{
+		{"empty", nil, ErrInvalidSignature},
+		{"one byte short", sig.Bytes()[:SignatureLength-1], ErrInvalidSignature},
+		{"one byte over", append(sig.Bytes(), 0), ErrInvalidSignature},
+		{"zero r", encode(big.NewInt(0), sig.S()), ErrInvalidSignature},
+		{"zero s", encode(sig.R(), big.NewInt(0)), ErrInvalidSignature},
+		{"r equal to the order", encode(n, sig.S()), ErrInvalidSignature},
+		{"s replaced by N-s", encode(sig.R(), highS), ErrHighS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSignature(tt.b); !errors.Is(err, tt.want) {
+				t.Fatalf("ParseSignature: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsHighS(t *testing.T) {
+	key := newTestKey(t)
+	hash := sha256.Sum256([]byte("message"))
+	sig, err := Sign(key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (r, N-s) passes plain ECDSA verification, which is exactly what makes
+	// it a malleated copy.
+	highS := new(big.Int).Sub(elliptic.P256().Params().N, sig.S())
+	if !ecdsa.Verify(&key.PublicKey, hash[:], sig.R(), highS) {
+		t.Fatal("ecdsa.Verify rejects (r, N-s)")
+	}
+	var malleated Signature
+	copy(malleated[:], encode(sig.R(), highS))
+	if malleated.Verify(&key.PublicKey, hash[:]) {
+		t.Fatal("Verify accepts (r, N-s)")
+	}
+}
@@ -46,6 +46,16 @@ func PublicKeyToBytes(publicKey *ecdsa.PublicKey) ([]byte) {
 	return append(publicKey.X.Bytes(), publicKey.Y.Bytes()...)
 }
 
+// PublicKeyToFixedBytes encodes a public key as X and Y each left-padded to
+// 32 bytes. Unlike PublicKeyToBytes the result always has the same length,
+// so BytesToPublicKey can split it back in half reliably.
+func PublicKeyToFixedBytes(publicKey *ecdsa.PublicKey) []byte {
+	buf := make([]byte, 64)
+	publicKey.X.FillBytes(buf[:32])
+	publicKey.Y.FillBytes(buf[32:])
+	return buf
+}
+
 func BytesToPublicKey(pubKeyBytes []byte) (*ecdsa.PublicKey, error) {
 	curve := elliptic.P256()
 	keyLen := len(pubKeyBytes) / 2
@@ -71,7 +81,13 @@ func PublicKeyHashRipeMD160(pubKey *ecdsa.PublicKey) []byte {
 }
 
 func GenerateAddress(publicKey *ecdsa.PublicKey) string {
-	publicKeyHash := PublicKeyHashRipeMD160(publicKey)
+	return AddressFromPubKeyHash(PublicKeyHashRipeMD160(publicKey))
+}
+
+// AddressFromPubKeyHash returns the address of the key with the given
+// PublicKeyHashRipeMD160. It is the inverse of PubKeyFromAddress.
+func AddressFromPubKeyHash(publicKeyHash []byte) string {
+	publicKeyHash = append([]byte(nil), publicKeyHash...)
 	checkSum := calculateCheckSum(publicKeyHash)
 	finalHash := append(publicKeyHash, checkSum...)
 	return base58.Encode(finalHash)
@@ -228,6 +244,9 @@ func PubKeyFromAddress(address string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(checksumHash) <= CHECK_SUM_LENGTH {
+		return nil, errors.New("this is not a valid address!!!!")
+	}
 	checksumOffset := len(checksumHash) - CHECK_SUM_LENGTH
 	actualChecksum := checksumHash[checksumOffset:]
 	pubKeyHash := checksumHash[0:checksumOffset]
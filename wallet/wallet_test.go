@@ -0,0 +1,21 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPubKeyFromAddress(t *testing.T) {
+	hash := bytes.Repeat([]byte{7}, 20)
+	got, err := PubKeyFromAddress(AddressFromPubKeyHash(hash))
+	if err != nil || !bytes.Equal(got, hash) {
+		t.Fatalf("PubKeyFromAddress(AddressFromPubKeyHash(%x)) = %x, %v", hash, got, err)
+	}
+
+	// Inputs no longer than the checksum are rejected instead of panicking.
+	for _, address := range []string{"", "1", "2g", "3yQ", "11111"} {
+		if _, err := PubKeyFromAddress(address); err == nil {
+			t.Errorf("PubKeyFromAddress(%q) succeeded", address)
+		}
+	}
+}